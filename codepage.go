@@ -0,0 +1,140 @@
+package tnef
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// codePages maps the Windows code pages, as used in attOemCodepage and
+// PR_MESSAGE_CODEPAGE, to their encoding. Strings in other code pages,
+// including UTF-8 (65001), are left as they are.
+var codePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	852:   charmap.CodePage852,
+	855:   charmap.CodePage855,
+	858:   charmap.CodePage858,
+	860:   charmap.CodePage860,
+	862:   charmap.CodePage862,
+	863:   charmap.CodePage863,
+	865:   charmap.CodePage865,
+	866:   charmap.CodePage866,
+	874:   charmap.Windows874,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	10000: charmap.Macintosh,
+	20866: charmap.KOI8R,
+	21866: charmap.KOI8U,
+	28591: charmap.ISO8859_1,
+	28592: charmap.ISO8859_2,
+	28593: charmap.ISO8859_3,
+	28594: charmap.ISO8859_4,
+	28595: charmap.ISO8859_5,
+	28596: charmap.ISO8859_6,
+	28597: charmap.ISO8859_7,
+	28598: charmap.ISO8859_8,
+	28599: charmap.ISO8859_9,
+	28603: charmap.ISO8859_13,
+	28605: charmap.ISO8859_15,
+	50220: japanese.ISO2022JP,
+	51932: japanese.EUCJP,
+	51949: korean.EUCKR,
+	54936: simplifiedchinese.GB18030,
+}
+
+// isASCII reports if s is the same in all supported code pages.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 || s[i] == 0x1b { // ESC starts an ISO-2022-JP sequence
+			return false
+		}
+	}
+	return true
+}
+
+// decodeString8 converts s, an 8-bit string in code page cp, to UTF-8.
+func decodeString8(cp int, s string) string {
+	e := codePages[cp]
+	if e == nil || isASCII(s) {
+		return s
+	}
+	out, err := e.NewDecoder().String(s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// encodeString8 converts s to code page cp. Characters that aren't in the code
+// page are replaced.
+func encodeString8(cp int, s string) string {
+	e := codePages[cp]
+	if e == nil || isASCII(s) {
+		return s
+	}
+	out, err := encoding.ReplaceUnsupported(e.NewEncoder()).String(s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// CodePage returns the code page of the PT_STRING8 properties of the
+// message: PR_MESSAGE_CODEPAGE or PR_INTERNET_CPID if they're set, and
+// otherwise OEMCodePage.
+func (c *Data) CodePage() int {
+	if cp, ok := c.GetInt32(MAPIMessageCodepage); ok && cp > 0 {
+		return int(cp)
+	}
+	if cp, ok := c.GetInt32(MAPIInternetCodepage); ok && cp > 0 {
+		return int(cp)
+	}
+	return c.OEMCodePage
+}
+
+// decodeStrings converts the PT_STRING8 values in l from code page cp to
+// UTF-8. Raw is left as it is.
+func (l MsgPropertyList) decodeStrings(cp int) {
+	for _, v := range l.Values {
+		switch d := v.Data.(type) {
+		case string:
+			if v.TagType == szmapiString {
+				v.Data = decodeString8(cp, d)
+			}
+		case []string:
+			if v.TagType == szmapiString|mvFlag {
+				for i := range d {
+					d[i] = decodeString8(cp, d[i])
+				}
+			}
+		}
+	}
+}
+
+// bodyValue returns the value of a body property as it's stored in Data,
+// converted to UTF-8: a PT_STRING8 body from code page cp, and a PT_UNICODE
+// body from UTF-16.
+func bodyValue(v *Property, cp int) []byte {
+	switch v.TagType {
+	case szmapiString:
+		return []byte(decodeString8(cp, string(v.Raw)))
+	case szmapiUnicodeString:
+		return []byte(decodeUTF16(v.Raw))
+	}
+	return v.Raw
+}
@@ -0,0 +1,180 @@
+package tnef
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodePages(t *testing.T) {
+	signature := []byte{0x78, 0x9f, 0x3e, 0x22, 0, 0}
+	oem := func(cp int) []byte {
+		return tnefAttr(lvlMessage, ATTOEMCODEPAGE, atpByte, append(le32(cp), le32(0)...))
+	}
+	props := func(cp int, values ...*Property) []byte {
+		data, err := encodeMsgPropertyList(MsgPropertyList{Values: values}, cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	shiftJIS := []byte{0x93, 0xfa, 0x96, 0x7b} // 日本
+
+	tests := []struct {
+		name  string
+		in    []byte
+		check func(*Data) (got, want string)
+	}{
+		{
+			"subject in cp932",
+			bytes.Join([][]byte{
+				signature, oem(932),
+				tnefAttr(lvlMessage, ATTSUBJECT, atpString, append(shiftJIS, 0)),
+			}, nil),
+			func(d *Data) (string, string) { return d.Subject, "日本" },
+		},
+		{
+			"no code page",
+			bytes.Join([][]byte{
+				signature,
+				tnefAttr(lvlMessage, ATTSUBJECT, atpString, append(shiftJIS, 0)),
+			}, nil),
+			func(d *Data) (string, string) { return d.Subject, string(shiftJIS) },
+		},
+		{
+			"attachment title in cp1250",
+			bytes.Join([][]byte{
+				signature, oem(1250),
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, atpByte, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHTITLE, atpString, []byte("\x8elu\x9dou\xe8k\xfd k\xf9\xf2.txt\x00")),
+			}, nil),
+			func(d *Data) (string, string) { return d.Attachments[0].Title, "Žluťoučký kůň.txt" },
+		},
+		{
+			"PR_MESSAGE_CODEPAGE",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(1251,
+					&Property{TagType: szmapiString, TagId: MAPISubject, Data: "Привет"},
+					&Property{TagType: szmapiInt, TagId: MAPIMessageCodepage, Data: int32(1251)},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { s, _ := d.GetString(MAPISubject); return s, "Привет" },
+		},
+		{
+			"PR_INTERNET_CPID",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(20866,
+					&Property{TagType: szmapiString, TagId: MAPIBody, Data: "Привет"},
+					&Property{TagType: szmapiInt, TagId: MAPIInternetCodepage, Data: int32(20866)},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { return string(d.Body), "Привет\x00" },
+		},
+		{
+			"Unicode body",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(1252,
+					&Property{TagType: szmapiUnicodeString, TagId: MAPIBody, Data: "Привет"},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { return string(d.Body), "Привет" },
+		},
+		{
+			"RTF body",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(1252,
+					&Property{TagType: szmapiBinary, TagId: MAPIRtfCompressed,
+						Data: storeRTF([]byte(`{\rtf1\ansi\ansicpg1251\fromtext \'cf\'f0\'e8\'e2\'e5\'f2}`))},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { return string(d.Body), "Привет" },
+		},
+		{
+			"RTF body without \\ansicpg",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(1251,
+					&Property{TagType: szmapiInt, TagId: MAPIMessageCodepage, Data: int32(1251)},
+					&Property{TagType: szmapiBinary, TagId: MAPIRtfCompressed,
+						Data: storeRTF([]byte(`{\rtf1\ansi\fromtext \'cf\'f0\'e8\'e2\'e5\'f2}`))},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { return string(d.Body), "Привет" },
+		},
+		{
+			"attachment properties",
+			bytes.Join([][]byte{
+				signature, oem(1252),
+				tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte, props(932,
+					&Property{TagType: szmapiInt, TagId: MAPIMessageCodepage, Data: int32(932)},
+				)),
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, atpByte, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHMENT, atpByte, props(932,
+					&Property{TagType: szmapiString, TagId: MAPIAttachLongFilename, Data: "日本.txt"},
+				)),
+			}, nil),
+			func(d *Data) (string, string) { return d.Attachments[0].Title, "日本.txt" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Decode(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := tt.check(out); got != want {
+				t.Errorf("Decode: got %q; want %q", got, want)
+			}
+
+			out, err = DecodeReader(bytes.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := tt.check(out); got != want {
+				t.Errorf("DecodeReader: got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCodePagesFixture(t *testing.T) {
+	out, err := Decode(read(t, "./testdata", "MAPI_ATTACH_DATA_OBJ.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.OEMCodePage != 1252 || out.CodePage() != 1252 {
+		t.Errorf("wrong code pages: %d, %d", out.OEMCodePage, out.CodePage())
+	}
+	if s, _ := out.GetString(MAPISubject); s != "Bodø-damer på vei!" {
+		t.Errorf("wrong subject: %q", s)
+	}
+}
+
+func TestEncodeCodePage(t *testing.T) {
+	want := &Data{
+		OEMCodePage: 932,
+		Subject:     "日本語の件名",
+		Body:        []byte("本文"),
+		Attachments: []*Attachment{{Title: "ファイル.txt", Data: []byte("x")}},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte{0x93, 0xfa, 0x96, 0x7b}) {
+		t.Error("the subject isn't encoded in Shift-JIS")
+	}
+
+	out, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareData(t, out, want)
+	if out.OEMCodePage != 932 {
+		t.Errorf("wrong OEMCodePage: %d", out.OEMCodePage)
+	}
+}
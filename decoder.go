@@ -0,0 +1,441 @@
+package tnef
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// Attribute is a single attribute from a TNEF stream. Compare Name to the
+// ATT* constants to find out what kind of attribute it is.
+type Attribute struct {
+	Level int
+	Name  int
+	Type  int
+	Data  []byte
+}
+
+// Decoder reads the attributes of a TNEF stream one at a time, so that large
+// files don't have to be held in memory at once:
+//
+//	d := tnef.NewDecoder(r)
+//	for d.Next() {
+//		attr := d.Attribute()
+//		// ...
+//	}
+//	if err := d.Err(); err != nil {
+//		// ...
+//	}
+//
+// Attachments can be read in the same way with NextAttachment, which streams
+// the attachment data rather than reading it into memory:
+//
+//	for d.NextAttachment() {
+//		a := d.Attachment()
+//		io.Copy(dst, a.Open())
+//	}
+//
+// Next and NextAttachment should not be mixed on the same Decoder.
+type Decoder struct {
+	r       *bufio.Reader
+	cr      *countingReader
+	obj     tnefObject
+	started bool
+	done    bool
+	err     error
+	opts    DecodeOptions
+	lim     *limiter
+
+	message    *Data
+	attachment *Attachment
+	body       *attachmentReader
+}
+
+// NewDecoder returns a Decoder that reads TNEF data from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return DecodeOptions{}.NewDecoder(r)
+}
+
+// NewDecoder is like the package level NewDecoder, but uses the options in o.
+func (o DecodeOptions) NewDecoder(r io.Reader) *Decoder {
+	cr := &countingReader{r: r}
+	return &Decoder{r: bufio.NewReader(cr), cr: cr, opts: o, lim: newLimiter(o.Limits)}
+}
+
+// Next advances the Decoder to the next attribute, which will then be
+// available through Attribute. It returns false when the end of the stream is
+// reached or an error occurred; Err tells the two apart.
+//
+// Like Decode, an attribute that runs past the end of the stream (e.g. garbage
+// at the end of the file) ends the stream without an error.
+func (d *Decoder) Next() bool {
+	if !d.start() {
+		return false
+	}
+
+	obj, ok, err := d.readObject()
+	if err != nil {
+		d.err = err
+		return false
+	}
+	if !ok {
+		d.done = true
+		return false
+	}
+	d.obj = obj
+	return true
+}
+
+// Attribute returns the attribute read by the last call to Next.
+func (d *Decoder) Attribute() *Attribute {
+	return &d.obj.Attribute
+}
+
+// Err returns the first error encountered by the Decoder, if any.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// NextAttachment advances the Decoder to the next attachment, which will then
+// be available through Attachment. Message level attributes found along the
+// way are added to Message. It returns false when there are no more
+// attachments or an error occurred; Err tells the two apart.
+//
+// Any data of the previous attachment that wasn't read is skipped.
+func (d *Decoder) NextAttachment() bool {
+	if !d.start() {
+		return false
+	}
+	if d.body != nil {
+		if _, err := io.Copy(ioutil.Discard, d.body); err != nil {
+			d.setErr(err)
+			return false
+		}
+	}
+
+	d.attachment = nil
+	for {
+		obj, attLength, ok, err := d.peekObject()
+		if err != nil {
+			d.err = err
+			return false
+		}
+		if !ok {
+			d.done = true
+			return d.attachment != nil && d.endAttachment()
+		}
+
+		if d.attachment != nil {
+			if obj.Level != lvlAttachment || obj.Name == ATTATTACHRENDDATA {
+				// The next attachment or message attribute.
+				return d.endAttachment()
+			}
+			if obj.Name == ATTATTACHDATA {
+				d.r.Discard(tnefObjectHeaderLength)
+				d.body = &attachmentReader{d: d, obj: obj, n: attLength}
+				d.attachment.r = d.body
+				return true
+			}
+		}
+
+		obj, ok, err = d.readObject()
+		if err != nil || !ok {
+			d.err = err
+			d.done = true
+			return d.attachment != nil && err == nil && d.endAttachment()
+		}
+
+		switch {
+		case obj.Level == lvlAttachment && obj.Name == ATTATTACHRENDDATA:
+			if err = d.lim.addAttachment(); err != nil {
+				err = obj.inAttribute(err)
+			}
+			d.attachment = new(Attachment)
+		case obj.Level == lvlAttachment:
+			// Attachment attributes without an attAttachRendData are
+			// ignored, as in Decode.
+			if d.attachment != nil {
+				err = d.attachment.addAttr(obj, d.lim, d.Message())
+			}
+		default:
+			err = d.Message().addObject(obj, d.lim)
+		}
+		if err != nil {
+			d.err = err
+			return false
+		}
+	}
+}
+
+// endAttachment is called once all attributes of the current attachment have
+// been read, and reports if there was no error.
+func (d *Decoder) endAttachment() bool {
+	d.err = d.attachment.decodeEmbedded(d.opts, d.lim, 0)
+	return d.err == nil
+}
+
+// Attachment returns the attachment read by the last call to NextAttachment.
+// The attachment properties stored after the data are only available once
+// the data has been read to the end.
+func (d *Decoder) Attachment() *Attachment {
+	return d.attachment
+}
+
+// Message returns the message level attributes read so far by
+// NextAttachment. The attachments are not kept in its Attachments.
+//
+// Warnings about any of the attributes read so far, including those read by
+// Next, are added to its Warnings.
+func (d *Decoder) Message() *Data {
+	if d.message == nil {
+		d.message = &Data{
+			Attachments: []*Attachment{},
+		}
+	}
+	return d.message
+}
+
+// start reads the TNEF signature on the first call, and reports if the Decoder
+// can continue reading.
+func (d *Decoder) start() bool {
+	if d.done || d.err != nil {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		d.err = d.readSignature()
+	}
+	return d.err == nil
+}
+
+// setErr records err, treating a stream that ends in the middle of an
+// attribute as the end of the stream.
+func (d *Decoder) setErr(err error) {
+	if err == io.ErrUnexpectedEOF {
+		d.done = true
+		return
+	}
+	d.err = err
+}
+
+// readSignature reads the TNEF signature and the legacy key that follows it.
+func (d *Decoder) readSignature() error {
+	header, err := readFull(d.r, 6)
+	if len(header) < 4 || byteToInt(header[0:4]) != tnefSignature {
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		return ErrNoMarker
+	}
+	//key := binary.LittleEndian.Uint16(header[4:6])
+	return nil
+}
+
+// peekObject returns the header of the next TNEF object in the stream without
+// consuming it. ok is false if the stream ended.
+func (d *Decoder) peekObject() (obj tnefObject, attLength int, ok bool, err error) {
+	header, err := d.r.Peek(tnefObjectHeaderLength)
+	if len(header) < tnefObjectHeaderLength {
+		if err == io.EOF {
+			err = nil
+		}
+		return obj, 0, false, err
+	}
+
+	obj, attLength = decodeTNEFObjectHeader(header)
+	obj.Offset = d.offset()
+	return obj, attLength, true, nil
+}
+
+// offset returns the offset in the stream of the next byte to be read.
+func (d *Decoder) offset() int {
+	return d.cr.n - d.r.Buffered()
+}
+
+// countingReader counts the bytes read from r, so the Decoder knows the
+// offset of the attributes in the stream.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// readObject reads the next TNEF object from the stream. ok is false if the
+// stream ended, either cleanly or in the middle of an object.
+func (d *Decoder) readObject() (obj tnefObject, ok bool, err error) {
+	obj, attLength, ok, err := d.peekObject()
+	if !ok {
+		return obj, false, err
+	}
+	d.r.Discard(tnefObjectHeaderLength)
+	if attLength > d.lim.MaxOutputBytes-d.lim.output {
+		// Too much data, but only if it's really there: like in Decode,
+		// a bogus length at the end of a corrupt stream ends it.
+		if _, err := d.r.Discard(attLength + 2); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return obj, false, err
+		}
+		return obj, false, d.lim.addAttribute(obj, attLength)
+	}
+	d.lim.addOutput(attLength)
+
+	// Read the data and the checksum after it.
+	data, err := readFull(d.r, attLength+2)
+	if err == io.ErrUnexpectedEOF {
+		return obj, false, nil
+	}
+	if err != nil {
+		return obj, false, err
+	}
+	obj.Data = data[:attLength]
+	obj.Checksum = uint16(byteToInt(data[attLength:]))
+
+	obj.Length = tnefObjectHeaderLength + attLength + 2
+	if err := d.Message().verifyChecksum(obj, checksum(obj.Data), d.opts.Strict); err != nil {
+		return obj, false, err
+	}
+	return obj, true, nil
+}
+
+// attachmentReader streams the data of an attAttachData attribute from the
+// Decoder. Once all data is read it reads the remaining attributes of the
+// attachment, so they're available when Read returns io.EOF.
+type attachmentReader struct {
+	d   *Decoder
+	obj tnefObject
+	n   int    // bytes of data left
+	sum uint16 // checksum of the data read so far
+	err error
+}
+
+func (r *attachmentReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.n == 0 {
+		r.err = r.d.finishAttachment(r)
+		if r.err == nil {
+			r.err = io.EOF
+		} else {
+			// NextAttachment stops at the error, and Err reports it.
+			r.d.setErr(r.err)
+		}
+		return 0, r.err
+	}
+
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.d.r.Read(p)
+	r.n -= n
+	if err == nil {
+		// The data is counted as it's read, as the length may be bogus.
+		err = r.d.lim.addAttribute(r.obj, n)
+	}
+	for _, b := range p[:n] {
+		r.sum += uint16(b)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		r.d.setErr(err)
+	}
+	r.err = err
+	return n, err
+}
+
+// finishAttachment reads the checksum of the attachment data and the
+// attachment attributes that follow it.
+func (d *Decoder) finishAttachment(r *attachmentReader) error {
+	d.body = nil
+	checksum, err := readFull(d.r, 2)
+	if err != nil {
+		return err
+	}
+	r.obj.Checksum = uint16(byteToInt(checksum))
+	if err := d.Message().verifyChecksum(r.obj, r.sum, d.opts.Strict); err != nil {
+		return err
+	}
+
+	for {
+		obj, _, ok, err := d.peekObject()
+		if err != nil {
+			return err
+		}
+		if !ok || obj.Level != lvlAttachment || obj.Name == ATTATTACHRENDDATA {
+			break
+		}
+
+		obj, ok, err = d.readObject()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := d.attachment.addAttr(obj, d.lim, d.Message()); err != nil {
+			return err
+		}
+	}
+	return d.attachment.decodeEmbedded(d.opts, d.lim, 0)
+}
+
+// readFull reads exactly n bytes from r. Unlike io.ReadFull the buffer grows
+// as the data comes in, so a bogus length in a corrupt file doesn't allocate a
+// huge buffer up front.
+func readFull(r io.Reader, n int) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+// DecodeReader is like Decode, but reads the TNEF data from r one attribute at
+// a time rather than requiring the entire file in memory up front.
+func DecodeReader(r io.Reader) (*Data, error) {
+	return DecodeOptions{}.DecodeReader(r)
+}
+
+// DecodeReader is like the package level DecodeReader, but uses the options
+// in o.
+func (o DecodeOptions) DecodeReader(r io.Reader) (*Data, error) {
+	if o.Recover {
+		// Finding the next attribute needs the data after a corrupt one.
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return o.Decode(data)
+	}
+
+	d := o.NewDecoder(r)
+	tnef := d.Message()
+
+	for d.Next() {
+		if err := tnef.addObject(d.obj, d.lim); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range tnef.Attachments {
+		if err := a.decodeEmbedded(o, d.lim, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return tnef, nil
+}
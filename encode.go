@@ -0,0 +1,608 @@
+package tnef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Attribute types, from the high word of the attribute IDs in [MS-OXTNEF].
+const (
+	atpTriples = 0x0000
+	atpString  = 0x0001
+	atpText    = 0x0002
+	atpDate    = 0x0003
+	atpShort   = 0x0004
+	atpLong    = 0x0005
+	atpByte    = 0x0006
+	atpWord    = 0x0007
+	atpDword   = 0x0008
+)
+
+const (
+	// tnefKey is the legacy key written after the signature; readers don't
+	// use it, but it must not be zero.
+	tnefKey = 0x0001
+
+	// tnefVersion is the value of attTnefVersion in [MS-OXTNEF].
+	tnefVersion = 0x00010000
+
+	// oemCodePage is written to attOemCodepage if Data has no OEMCodePage.
+	oemCodePage = 1252
+)
+
+// iidIMessage is the IID stored before the TNEF stream of an embedded message
+// in the MAPIAttachDataObj property: {00020307-0000-0000-C000-000000000046}.
+var iidIMessage = []byte{
+	0x07, 0x03, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
+}
+
+// Encode writes d to w in the TNEF format, e.g. to create a winmail.dat file.
+//
+// The message attributes, recipients, bodies, MAPI properties and attachments
+// are written. Attachments are written from Data and Properties; the
+// attachment data isn't read from Open.
+func Encode(w io.Writer, d *Data) error {
+	e := tnefEncoder{w: w, oemCodePage: d.OEMCodePage, codePage: d.CodePage()}
+	if e.oemCodePage == 0 {
+		e.oemCodePage = oemCodePage
+	}
+	if e.codePage == 0 {
+		e.codePage = e.oemCodePage
+	}
+	e.signature()
+
+	e.attr(lvlMessage, ATTTNEFVERSION, atpDword, le32(tnefVersion))
+	e.attr(lvlMessage, ATTOEMCODEPAGE, atpByte, append(le32(e.oemCodePage), le32(0)...))
+	e.messageAttrs(d)
+
+	props, body := d.msgProps()
+	if len(body) > 0 {
+		e.attr(lvlMessage, ATTBODY, atpText, []byte(encodeString8(e.oemCodePage, string(body))))
+	}
+	if len(props.Values) > 0 {
+		data, err := encodeMsgPropertyList(props, e.codePage)
+		if err != nil {
+			return err
+		}
+		e.attr(lvlMessage, ATTMAPIPROPS, atpByte, data)
+	}
+
+	// The recipients come after the properties, so the code page of their
+	// strings is known when they're decoded.
+	if len(d.Recipients) > 0 {
+		data, err := encodeRecipientTable(d.Recipients, e.codePage)
+		if err != nil {
+			return err
+		}
+		e.attr(lvlMessage, ATTRECIPTABLE, atpByte, data)
+	}
+
+	for _, a := range d.Attachments {
+		if err := e.attachment(a); err != nil {
+			return err
+		}
+	}
+	return e.err
+}
+
+// tnefEncoder writes TNEF objects, and remembers the first error so the
+// callers don't have to check every write.
+type tnefEncoder struct {
+	w   io.Writer
+	err error
+
+	oemCodePage int // of the strings in attributes
+	codePage    int // of the PT_STRING8 properties
+}
+
+func (e *tnefEncoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *tnefEncoder) signature() {
+	b := le32(tnefSignature)
+	b = append(b, le16(tnefKey)...)
+	e.write(b)
+}
+
+/**
+ * Object = Level Name Type Length Data Checksum
+ *
+ * The checksum is the sum of the data bytes, modulo 65536.
+ */
+func (e *tnefEncoder) attr(level, name, typ int, data []byte) {
+	b := make([]byte, 0, tnefObjectHeaderLength)
+	b = append(b, byte(level))
+	b = append(b, le16(name)...)
+	b = append(b, le16(typ)...)
+	b = append(b, le32(len(data))...)
+	e.write(b)
+	e.write(data)
+	e.write(le16(int(checksum(data))))
+}
+
+// messageAttrs writes the message attributes that are set in d.
+func (e *tnefEncoder) messageAttrs(d *Data) {
+	if len(d.MessageClass) > 0 {
+		e.attr(lvlMessage, ATTMESSAGECLASS, atpWord, encodeAttrString(string(d.MessageClass)))
+	}
+	if d.From != (Address{}) {
+		e.attr(lvlMessage, ATTFROM, atpTriples, encodeTRP(d.From, e.oemCodePage))
+	}
+	if d.Subject != "" {
+		e.attr(lvlMessage, ATTSUBJECT, atpString, encodeAttrString(encodeString8(e.oemCodePage, d.Subject)))
+	}
+	if !d.DateSent.IsZero() {
+		e.attr(lvlMessage, ATTDATESENT, atpDate, encodeAttrDate(d.DateSent))
+	}
+	if !d.DateReceived.IsZero() {
+		e.attr(lvlMessage, ATTDATERECD, atpDate, encodeAttrDate(d.DateReceived))
+	}
+	if d.MessageStatus != 0 {
+		e.attr(lvlMessage, ATTMESSAGESTATUS, atpByte, []byte{byte(d.MessageStatus)})
+	}
+	if d.MessageID != "" {
+		e.attr(lvlMessage, ATTMESSAGEID, atpString, encodeAttrString(d.MessageID))
+	}
+	if d.ParentID != "" {
+		e.attr(lvlMessage, ATTPARENTID, atpString, encodeAttrString(d.ParentID))
+	}
+	if d.ConversationID != "" {
+		e.attr(lvlMessage, ATTCONVERSATIONID, atpString, encodeAttrString(d.ConversationID))
+	}
+	if d.Priority != 0 {
+		e.attr(lvlMessage, ATTPRIORITY, atpShort, le16(int(d.Priority)))
+	}
+	if !d.DateModified.IsZero() {
+		e.attr(lvlMessage, ATTDATEMODIFY, atpDate, encodeAttrDate(d.DateModified))
+	}
+	if !d.DateStart.IsZero() {
+		e.attr(lvlMessage, ATTDATESTART, atpDate, encodeAttrDate(d.DateStart))
+	}
+	if !d.DateEnd.IsZero() {
+		e.attr(lvlMessage, ATTDATEEND, atpDate, encodeAttrDate(d.DateEnd))
+	}
+}
+
+// attachment writes the attributes of a single attachment.
+func (e *tnefEncoder) attachment(a *Attachment) error {
+	props, err := a.encodeProps(e.codePage)
+	if err != nil {
+		return err
+	}
+
+	/*
+		attAttachRendData = AttachType AttachPosition RenderWidth RenderHeight DataFlags
+	*/
+	attachType := 0x0001 // AttachTypeFile
+	if a.attachMethod() == AttachOLE {
+		attachType = 0x0002 // AttachTypeOle
+	}
+	rend := le16(attachType)
+	rend = append(rend, le32(-1)...) // AttachPosition; -1 means hidden
+	rend = append(rend, 0, 0, 0, 0)  // RenderWidth, RenderHeight
+	rend = append(rend, le32(0)...)  // FileDataDefault
+	e.attr(lvlAttachment, ATTATTACHRENDDATA, atpByte, rend)
+
+	if a.Title != "" {
+		e.attr(lvlAttachment, ATTATTACHTITLE, atpString, encodeAttrString(encodeString8(e.oemCodePage, a.Title)))
+	}
+	if !a.CreationTime.IsZero() {
+		e.attr(lvlAttachment, ATTATTACHCREATEDATE, atpDate, encodeAttrDate(a.CreationTime))
+	}
+	if !a.LastModificationTime.IsZero() {
+		e.attr(lvlAttachment, ATTATTACHMODIFYDATE, atpDate, encodeAttrDate(a.LastModificationTime))
+	}
+	if a.Data != nil {
+		e.attr(lvlAttachment, ATTATTACHDATA, atpByte, a.Data)
+	}
+	e.attr(lvlAttachment, ATTATTACHMENT, atpByte, props)
+	return nil
+}
+
+// encodeProps encodes the properties of the attachment. If there are none the
+// essential ones are created from the other fields, and EmbeddedMessage is
+// added if it's not already in the properties.
+func (a *Attachment) encodeProps(cp int) ([]byte, error) {
+	values := a.Properties.Values
+	if len(values) == 0 {
+		method := AttachByValue
+		if a.EmbeddedMessage != nil {
+			method = AttachEmbeddedMsg
+		}
+		values = []*MsgPropertyValue{
+			{TagType: szmapiInt, TagId: MAPIAttachMethod, Data: int32(method)},
+		}
+		if a.Title != "" {
+			values = append(values, &MsgPropertyValue{
+				TagType: szmapiUnicodeString, TagId: MAPIAttachLongFilename, Data: a.Title,
+			})
+		}
+	}
+
+	if a.EmbeddedMessage != nil && a.Properties.get(MAPIAttachDataObj) == nil {
+		var buf bytes.Buffer
+		buf.Write(iidIMessage)
+		if err := Encode(&buf, a.EmbeddedMessage); err != nil {
+			return nil, err
+		}
+		values = append(values[:len(values):len(values)], &MsgPropertyValue{
+			TagType: szmapiObject, TagId: MAPIAttachDataObj, Data: buf.Bytes(),
+		})
+	}
+
+	return encodeMsgPropertyList(MsgPropertyList{Values: values}, cp)
+}
+
+// msgProps returns the MAPI properties of the message, with the bodies from
+// BodyHTML and BodyRTF. Body is only in the properties if it wasn't changed,
+// otherwise it's returned to be written as attBody, as the encoding of a new
+// body isn't known.
+func (d *Data) msgProps() (props MsgPropertyList, body []byte) {
+	body, html, rtf := d.Body, d.BodyHTML, d.BodyRTF
+	cp := d.CodePage()
+	for _, v := range d.Properties.Values {
+		// Properties that still match the bodies are kept as they are, so
+		// they're written in the original encoding.
+		switch {
+		case v.TagId == MAPIBody:
+			if body == nil || !bytes.Equal(bodyValue(v, cp), body) {
+				continue
+			}
+			body = nil
+		case v.TagId == MAPIBodyHTML:
+			if html == nil || !bytes.Equal(v.Raw, html) {
+				continue
+			}
+			html = nil
+		case v.TagId == MAPIRtfCompressed:
+			if b, err := DecompressRTF(v.Raw); rtf == nil || err != nil || !bytes.Equal(b, rtf) {
+				continue
+			}
+			rtf = nil
+		}
+		props.Values = append(props.Values, v)
+	}
+
+	if len(html) > 0 {
+		props.Values = append(props.Values, &Property{TagType: szmapiBinary, TagId: MAPIBodyHTML, Data: html})
+	}
+	if len(rtf) > 0 {
+		props.Values = append(props.Values, &Property{TagType: szmapiBinary, TagId: MAPIRtfCompressed, Data: storeRTF(rtf)})
+	}
+	return props, body
+}
+
+/**
+ * RecipientTable = RecipientCount *RecipientRow
+ *
+ * Recipients without properties get the essential ones from their Address.
+ */
+func encodeRecipientTable(recipients []Recipient, cp int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(le32(len(recipients)))
+	for _, r := range recipients {
+		props := r.Properties
+		if len(props.Values) == 0 {
+			props.Values = []*MsgPropertyValue{
+				{TagType: szmapiUnicodeString, TagId: MAPIDisplayName, Data: r.DisplayName},
+				{TagType: szmapiUnicodeString, TagId: MAPIAddrtype, Data: r.AddressType},
+				{TagType: szmapiUnicodeString, TagId: MAPIEmailAddress, Data: r.EmailAddress},
+				{TagType: szmapiInt, TagId: MAPIRecipientType, Data: int32(r.Type)},
+			}
+		}
+		data, err := encodeMsgPropertyList(props, cp)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+/**
+ *  MsgPropertyList = MsgPropertyCount *MsgPropertyValue
+ *  MsgPropertyValue = MsgPropertyTag MsgPropertyData
+ *
+ * The values are encoded from the Go types that decodeMsgPropertyList
+ * creates for each property type.
+ */
+func encodeMsgPropertyList(list MsgPropertyList, cp int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(le32(len(list.Values)))
+	for _, v := range list.Values {
+		if err := encodeMsgPropertyValue(&buf, v, cp); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeMsgPropertyValue(buf *bytes.Buffer, v *MsgPropertyValue, cp int) error {
+	//MsgPropertyTag = MsgPropertyType MsgPropertyId [NamedPropSpec]
+	buf.Write(le16(int(v.TagType)))
+	buf.Write(le16(int(v.TagId)))
+	if v.TagId >= 0x8000 {
+		// NamedPropSpec = PropNameSpace PropIDType PropMap
+		buf.Write(v.PropNameSpace[:])
+		buf.Write(le32(int(v.PropIDType)))
+		if v.PropIDType == 0 {
+			m := make([]byte, 4)
+			copy(m, v.PropMap)
+			buf.Write(m)
+		} else {
+			name := encodeUTF16(strings.TrimRight(string(v.PropMap), "\x00"))
+			buf.Write(le32(len(name)))
+			writePadded(buf, name)
+		}
+	}
+
+	invalid := func() error {
+		return fmt.Errorf("encodeMsgPropertyList: value %T is invalid for data type %#x", v.Data, v.TagType)
+	}
+
+	switch v.TagType {
+	case 0x0001: //NULL
+	case 0x0002: //Int16
+		n, ok := v.Data.(int16)
+		if !ok {
+			return invalid()
+		}
+		writePadded(buf, le16(int(n)))
+	case 0x1002: //TypeMVInt16
+		l, ok := v.Data.([]int16)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		var data []byte
+		for _, n := range l {
+			data = append(data, le16(int(n))...)
+		}
+		writePadded(buf, data)
+	case 0x0003, 0x000A: //TypeInt32, TypeErrorCode
+		n, ok := v.Data.(int32)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(int(n)))
+	case 0x1003: //TypeMVInt32
+		l, ok := v.Data.([]int32)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, n := range l {
+			buf.Write(le32(int(n)))
+		}
+	case 0x0004: //TypeFlt32
+		f, ok := v.Data.(float32)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(int(math.Float32bits(f))))
+	case 0x1004: //TypeMVFlt32
+		l, ok := v.Data.([]float32)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, f := range l {
+			buf.Write(le32(int(math.Float32bits(f))))
+		}
+	case 0x0005, 0x0007: //TypeFlt64, TypeAppTime
+		f, ok := v.Data.(float64)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le64(math.Float64bits(f)))
+	case 0x1005, 0x1007: //TypeMVFlt64, TypeMVAppTime
+		l, ok := v.Data.([]float64)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, f := range l {
+			buf.Write(le64(math.Float64bits(f)))
+		}
+	case 0x0006, 0x0014: //TypeCurrency, TypeInt64
+		n, ok := v.Data.(int64)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le64(uint64(n)))
+	case 0x1006, 0x1014: //TypeMVCurrency, TypeMVInt64
+		l, ok := v.Data.([]int64)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, n := range l {
+			buf.Write(le64(uint64(n)))
+		}
+	case 0x000B: //TypeBoolean
+		b, ok := v.Data.(bool)
+		if !ok {
+			return invalid()
+		}
+		n := 0
+		if b {
+			n = 1
+		}
+		buf.Write(le32(n))
+	case 0x000D, 0x0102: //TypeObject, TypeBinary
+		b, ok := v.Data.([]byte)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(1))
+		buf.Write(le32(len(b)))
+		writePadded(buf, b)
+	case 0x1102: //TypeMVBinary
+		l, ok := v.Data.([][]byte)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, b := range l {
+			buf.Write(le32(len(b)))
+			writePadded(buf, b)
+		}
+	case 0x001E, 0x001F, 0x101E, 0x101F: //TypeString8, TypeUnicode and their multi-value types
+		var l []string
+		switch s := v.Data.(type) {
+		case string:
+			l = []string{s}
+		case []string:
+			l = s
+		default:
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, s := range l {
+			var b []byte
+			if v.TagType&^mvFlag == 0x001F {
+				b = encodeUTF16(s)
+			} else {
+				b = append([]byte(encodeString8(cp, s)), 0)
+			}
+			buf.Write(le32(len(b)))
+			writePadded(buf, b)
+		}
+	case 0x0040: //TypeSystime
+		var n uint64
+		switch t := v.Data.(type) {
+		case time.Time:
+			n = timeToFiletime(t)
+		case uint64:
+			n = t
+		default:
+			return invalid()
+		}
+		buf.Write(le64(n))
+	case 0x1040: //TypeMVSystime
+		l, ok := v.Data.([]time.Time)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, t := range l {
+			buf.Write(le64(timeToFiletime(t)))
+		}
+	case 0x0048: //TypeCLSID
+		g, ok := v.Data.(GUID)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(g[:])
+	case 0x1048: //TypeMVCLSID
+		l, ok := v.Data.([]GUID)
+		if !ok {
+			return invalid()
+		}
+		buf.Write(le32(len(l)))
+		for _, g := range l {
+			buf.Write(g[:])
+		}
+	default:
+		return fmt.Errorf("encodeMsgPropertyList: data type %#x is invalid", v.TagType)
+	}
+	return nil
+}
+
+// encodeAttrString encodes a null terminated atpString attribute.
+func encodeAttrString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+/**
+ * attDate = Year Month Day Hour Minute Second DayOfWeek
+ */
+func encodeAttrDate(t time.Time) []byte {
+	t = t.UTC()
+	var b []byte
+	for _, n := range []int{t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second(), int(t.Weekday())} {
+		b = append(b, le16(n)...)
+	}
+	return b
+}
+
+/**
+ * attFrom = TRP sender-display-name sender-address TRP-ending
+ * TRP = trpidOneOff cbgrtrp cch cbRgb
+ *
+ * The name and address are padded to an even length, and the list of TRPs
+ * ends with an empty TRP.
+ */
+func encodeTRP(addr Address, cp int) []byte {
+	name := append([]byte(encodeString8(cp, addr.DisplayName)), 0)
+	email := addr.EmailAddress
+	if addr.AddressType != "" {
+		email = addr.AddressType + ":" + email
+	}
+	address := append([]byte(email), 0)
+
+	cch, cbRgb := len(name), len(address)
+	name = append(name, make([]byte, cch&1)...)
+	address = append(address, make([]byte, cbRgb&1)...)
+
+	b := le16(0x0004) // trpidOneOff
+	b = append(b, le16(8+len(name)+len(address))...)
+	b = append(b, le16(cch)...)
+	b = append(b, le16(cbRgb)...)
+	b = append(b, name...)
+	b = append(b, address...)
+	return append(b, make([]byte, 8)...)
+}
+
+// encodeUTF16 encodes s as null terminated UTF-16LE.
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s + "\x00"))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// writePadded writes data followed by zeros up to a multiple of 4 bytes.
+func writePadded(buf *bytes.Buffer, data []byte) {
+	buf.Write(data)
+	buf.Write(make([]byte, -len(data)&3))
+}
+
+// checksum calculates the checksum of the data of a TNEF object.
+func checksum(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return sum
+}
+
+func le16(n int) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, uint16(n))
+	return b
+}
+
+func le32(n int) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(n))
+	return b
+}
+
+func le64(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n)
+	return b
+}
@@ -0,0 +1,258 @@
+package tnef
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []string{
+		"attachments",
+		"body",
+		"data-before-name",
+		"MAPI_ATTACH_DATA_OBJ",
+		"missing-filenames",
+		"multi-value-attribute",
+		"rtf",
+		"triples",
+		"two-files",
+		"unicode-mapi-attr",
+		"unicode-mapi-attr-name",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			want, err := Decode(read(t, "./testdata", tt+".tnef"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := Encode(&buf, want); err != nil {
+				t.Fatal(err)
+			}
+			verifyChecksums(t, buf.Bytes())
+
+			out, err := Decode(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareData(t, out, want)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	date := time.Date(2018, 11, 2, 13, 14, 15, 0, time.UTC)
+	inner := &Data{
+		Subject: "Forwarded",
+		Body:    []byte("inner body"),
+	}
+	want := &Data{
+		MessageClass: []byte("IPM.Note"),
+		From: Address{
+			DisplayName:  "Sender",
+			AddressType:  "SMTP",
+			EmailAddress: "sender@example.com",
+		},
+		Subject:       "Hello, world",
+		DateSent:      date,
+		DateReceived:  date.Add(time.Minute),
+		DateStart:     date.Add(time.Hour),
+		DateEnd:       date.Add(2 * time.Hour),
+		MessageStatus: MessageStatusRead,
+		MessageID:     "1234",
+		Priority:      PriorityHigh,
+		TNEFVersion:   tnefVersion,
+		Body:          []byte("The body."),
+		BodyHTML:      []byte("<p>The body.</p>"),
+		BodyRTF:       []byte(`{\rtf1 The body.}`),
+		Recipients: []Recipient{{
+			Address: Address{DisplayName: "To", AddressType: "SMTP", EmailAddress: "to@example.com"},
+			Type:    RecipientTo,
+		}},
+		Attachments: []*Attachment{
+			{Title: "file.txt", Data: []byte("contents"), CreationTime: date, LastModificationTime: date.Add(time.Hour)},
+			{Title: "Forwarded", EmbeddedMessage: inner},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	verifyChecksums(t, buf.Bytes())
+
+	out, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareData(t, out, want)
+	if out.MessageStatus != want.MessageStatus || out.Priority != want.Priority ||
+		out.MessageID != want.MessageID || out.TNEFVersion != want.TNEFVersion {
+		t.Errorf("wrong message attributes: %#v", out)
+	}
+	for i, r := range out.Recipients {
+		if r.Address != want.Recipients[i].Address || r.Type != want.Recipients[i].Type {
+			t.Errorf("wrong recipient %d\ngot:  %#v\nwant: %#v", i, r, want.Recipients[i])
+		}
+	}
+
+	msg := out.Attachments[1].EmbeddedMessage
+	if msg == nil {
+		t.Fatal("EmbeddedMessage is nil")
+	}
+	if msg.Subject != inner.Subject || !bytes.Equal(msg.Body, inner.Body) {
+		t.Errorf("wrong embedded message: %#v", msg)
+	}
+}
+
+func TestEncodeMsgPropertyList(t *testing.T) {
+	psPublicStrings, _ := ParseGUID("{00020329-0000-0000-C000-000000000046}")
+	psetidCommon, _ := ParseGUID("{00062008-0000-0000-C000-000000000046}")
+	want := MsgPropertyList{Values: []*MsgPropertyValue{
+		{TagType: 0x0002, TagId: 0x0001, Data: int16(-2)},
+		{TagType: 0x1002, TagId: 0x0002, Data: []int16{1, 2, 3}},
+		{TagType: 0x0003, TagId: 0x0003, Data: int32(-3)},
+		{TagType: 0x1003, TagId: 0x0004, Data: []int32{4, 5}},
+		{TagType: 0x0005, TagId: 0x0005, Data: 1.5},
+		{TagType: 0x0014, TagId: 0x0006, Data: int64(-6)},
+		{TagType: 0x000B, TagId: 0x0007, Data: true},
+		{TagType: 0x001E, TagId: 0x0008, Data: "string8 Привет"},
+		{TagType: 0x101E, TagId: 0x0009, Data: []string{"a", "bcd"}},
+		{TagType: 0x001F, TagId: 0x000A, Data: "unicode €"},
+		{TagType: 0x101F, TagId: 0x000B, Data: []string{"x", "yz"}},
+		{TagType: 0x0040, TagId: 0x000C, Data: time.Date(2016, 2, 15, 8, 53, 20, 0, time.UTC)},
+		{TagType: 0x1040, TagId: 0x000F, Data: []time.Time{time.Date(2001, 1, 2, 3, 4, 5, 600, time.UTC)}},
+		{TagType: 0x0102, TagId: 0x000D, Data: []byte{1, 2, 3, 4, 5}},
+		{TagType: 0x1102, TagId: 0x000E, Data: [][]byte{{1}, {2, 3}}},
+		{TagType: 0x0048, TagId: 0x0010, Data: psetidCommon},
+		{TagType: 0x1048, TagId: 0x0011, Data: []GUID{psPublicStrings, psetidCommon}},
+		{
+			TagType: 0x0003, TagId: 0x8001, Data: int32(7),
+			PropNameSpace: psPublicStrings, PropIDType: 0, PropMap: []byte{1, 0x85, 0, 0},
+		},
+		{
+			TagType: 0x001E, TagId: 0x8002, Data: "named",
+			PropNameSpace: psetidCommon, PropIDType: 1, PropMap: []byte("Keywords\x00"),
+		},
+	}}
+
+	data, err := encodeMsgPropertyList(want, 1251)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%4 != 0 {
+		t.Errorf("length %d is not padded to 4 bytes", len(data))
+	}
+
+	out, n, err := decodeMsgProperties(data, newLimiter(Limits{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.decodeStrings(1251)
+	if n != len(data) {
+		t.Errorf("decoded %d bytes; want %d", n, len(data))
+	}
+	if len(out.Values) != len(want.Values) {
+		t.Fatalf("decoded %d values; want %d", len(out.Values), len(want.Values))
+	}
+	for i, v := range out.Values {
+		w := want.Values[i]
+		if v.TagType != w.TagType || v.TagId != w.TagId || !reflect.DeepEqual(v.Data, w.Data) {
+			t.Errorf("value %d\ngot:  %#v\nwant: %#v", i, v, w)
+		}
+		if v.DataType == "" {
+			t.Errorf("value %d of type %#x has no DataType", i, v.TagType)
+		}
+		if w.TagId >= 0x8000 && (v.PropNameSpace != w.PropNameSpace ||
+			v.PropIDType != w.PropIDType || !bytes.Equal(v.PropMap, w.PropMap)) {
+			t.Errorf("wrong named property %d\ngot:  %#v\nwant: %#v", i, v, w)
+		}
+	}
+
+	_, err = encodeMsgPropertyList(MsgPropertyList{Values: []*MsgPropertyValue{
+		{TagType: 0x0003, TagId: 0x0001, Data: "not an int"},
+	}}, 0)
+	if !errorContains(err, "is invalid for data type 0x3") {
+		t.Errorf("wrong error for an invalid value: %v", err)
+	}
+}
+
+// verifyChecksums checks the checksum of every TNEF object in data.
+func verifyChecksums(t *testing.T, data []byte) {
+	t.Helper()
+	offset := 6
+	for offset < len(data) {
+		obj, ok := decodeTNEFObject(data[offset:])
+		if !ok {
+			t.Fatalf("invalid object at offset %d", offset)
+		}
+		sum := byteToInt(data[offset+obj.Length-2 : offset+obj.Length])
+		if want := int(checksum(obj.Data)); sum != want {
+			t.Errorf("wrong checksum for attribute %#x: %#x; want %#x", obj.Name, sum, want)
+		}
+		offset += obj.Length
+	}
+}
+
+// compareData compares the fields of Data that Encode writes.
+func compareData(t *testing.T, out, want *Data) {
+	t.Helper()
+	if out.Subject != want.Subject || out.From != want.From ||
+		!bytes.Equal(out.MessageClass, want.MessageClass) {
+		t.Errorf("wrong message attributes\ngot:  %q %#v %q\nwant: %q %#v %q",
+			out.Subject, out.From, out.MessageClass, want.Subject, want.From, want.MessageClass)
+	}
+	if !out.DateSent.Equal(want.DateSent) || !out.DateReceived.Equal(want.DateReceived) ||
+		!out.DateModified.Equal(want.DateModified) ||
+		!out.DateStart.Equal(want.DateStart) || !out.DateEnd.Equal(want.DateEnd) {
+		t.Errorf("wrong dates\ngot:  %v %v %v %v %v\nwant: %v %v %v %v %v",
+			out.DateSent, out.DateReceived, out.DateModified, out.DateStart, out.DateEnd,
+			want.DateSent, want.DateReceived, want.DateModified, want.DateStart, want.DateEnd)
+	}
+	if !bytes.Equal(out.Body, want.Body) {
+		t.Errorf("wrong Body\ngot:  %q\nwant: %q", out.Body, want.Body)
+	}
+	if !bytes.Equal(out.BodyHTML, want.BodyHTML) {
+		t.Errorf("wrong BodyHTML\ngot:  %q\nwant: %q", out.BodyHTML, want.BodyHTML)
+	}
+	if !bytes.Equal(out.BodyRTF, want.BodyRTF) {
+		t.Errorf("wrong BodyRTF\ngot:  %q\nwant: %q", out.BodyRTF, want.BodyRTF)
+	}
+
+	// New bodies are added after the properties that were decoded.
+	if len(out.Properties.Values) < len(want.Properties.Values) {
+		t.Fatalf("wrong number of properties: %d; want at least %d",
+			len(out.Properties.Values), len(want.Properties.Values))
+	}
+	for i, w := range want.Properties.Values {
+		v := out.Properties.Values[i]
+		if v.TagId != w.TagId || !reflect.DeepEqual(v.Data, w.Data) || !bytes.Equal(v.PropMap, w.PropMap) {
+			t.Errorf("wrong property %d\ngot:  %#v\nwant: %#v", i, v, w)
+		}
+	}
+	if len(out.Recipients) != len(want.Recipients) {
+		t.Errorf("wrong number of recipients: %d; want %d", len(out.Recipients), len(want.Recipients))
+	}
+	if len(out.Attachments) != len(want.Attachments) {
+		t.Fatalf("wrong number of attachments: %d; want %d", len(out.Attachments), len(want.Attachments))
+	}
+	for i, a := range out.Attachments {
+		w := want.Attachments[i]
+		if !a.CreationTime.Equal(w.CreationTime) || !a.LastModificationTime.Equal(w.LastModificationTime) {
+			t.Errorf("wrong dates in attachment %d\ngot:  %v %v\nwant: %v %v", i,
+				a.CreationTime, a.LastModificationTime, w.CreationTime, w.LastModificationTime)
+		}
+		if a.Title != w.Title || !bytes.Equal(a.Data, w.Data) {
+			t.Errorf("wrong attachment %d\ngot:  %q (%d bytes)\nwant: %q (%d bytes)",
+				i, a.Title, len(a.Data), w.Title, len(w.Data))
+		}
+		if len(w.Properties.Values) > 0 && len(a.Properties.Values) != len(w.Properties.Values) {
+			t.Errorf("wrong number of properties in attachment %d: %d; want %d",
+				i, len(a.Properties.Values), len(w.Properties.Values))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tnef
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Causes of an AttributeError or PropertyError, for use with errors.Is.
+var (
+	// ErrTruncated signals that a length or count runs past the end of the
+	// data it's in.
+	ErrTruncated = errors.New("data is truncated")
+
+	// ErrChecksum signals that the checksum of an attribute doesn't match
+	// its data.
+	ErrChecksum = errors.New("checksum doesn't match")
+
+	// ErrUnknownPropType signals a MAPI property with a type that isn't
+	// known, so the rest of the property list can't be decoded.
+	ErrUnknownPropType = errors.New("unknown property type")
+
+	// ErrLimitExceeded signals that the data exceeds one of the Limits.
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// AttributeError is returned when a TNEF attribute can't be decoded. Err is
+// the cause, which is a *PropertyError if a MAPI property in the attribute
+// couldn't be decoded.
+type AttributeError struct {
+	Offset int // offset in the TNEF stream where decoding failed
+	Level  int // lvlMessage or lvlAttachment
+	Name   int // the ATT* id of the attribute
+	Err    error
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("tnef: attribute %#04x (level %d) at offset %d: %v", e.Name, e.Level, e.Offset, e.Err)
+}
+
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+// PropertyError is returned, wrapped in an AttributeError, when a MAPI
+// property can't be decoded.
+type PropertyError struct {
+	Offset int    // offset in the TNEF stream where decoding failed
+	Tag    uint32 // the MAPI property tag (id and type)
+	Err    error
+}
+
+func (e *PropertyError) Error() string {
+	return fmt.Sprintf("property %#08x at offset %d: %v", e.Tag, e.Offset, e.Err)
+}
+
+func (e *PropertyError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is a flat view of an AttributeError or PropertyError, with the
+// attribute and property tag in one value; errors.As fills it from either.
+//
+// Deprecated: use AttributeError and PropertyError, which also have the cause
+// of the error for errors.Is.
+type DecodeError struct {
+	Offset    int    // offset in the TNEF stream where decoding failed
+	Attribute int    // the ATT* id of the attribute being decoded, if any
+	Tag       uint32 // the MAPI property tag (id and type) being decoded, if any
+	Msg       string
+}
+
+func (e *DecodeError) Error() string {
+	s := fmt.Sprintf("tnef: %s at offset %d", e.Msg, e.Offset)
+	if e.Attribute != 0 {
+		s += fmt.Sprintf(", attribute %#04x", e.Attribute)
+	}
+	if e.Tag != 0 {
+		s += fmt.Sprintf(", property %#08x", e.Tag)
+	}
+	return s
+}
+
+// As sets a *DecodeError target to the DecodeError for e.
+func (e *AttributeError) As(target interface{}) bool {
+	t, ok := target.(**DecodeError)
+	if !ok {
+		return false
+	}
+	*t = &DecodeError{Offset: e.Offset, Attribute: e.Name, Msg: e.Err.Error()}
+	var propErr *PropertyError
+	if errors.As(e.Err, &propErr) {
+		(*t).Tag, (*t).Msg = propErr.Tag, propErr.Err.Error()
+	}
+	return true
+}
+
+// As sets a *DecodeError target to the DecodeError for e.
+func (e *PropertyError) As(target interface{}) bool {
+	t, ok := target.(**DecodeError)
+	if ok {
+		*t = &DecodeError{Offset: e.Offset, Tag: e.Tag, Msg: e.Err.Error()}
+	}
+	return ok
+}
+
+// propTag returns the MAPI property tag for a property id and type.
+func propTag(id, typ int) uint32 {
+	return uint32(id)<<16 | uint32(typ)
+}
+
+// addOffset adds n to the offset of an error from decoding part of the data,
+// so it becomes relative to the start of the whole data.
+func addOffset(err error, n int) error {
+	switch e := err.(type) {
+	case *PropertyError:
+		e.Offset += n
+	case *AttributeError:
+		e.Offset += n
+	}
+	return err
+}
+
+// inAttribute returns an AttributeError for an error from decoding the data of
+// the attribute, where the offset is relative to the start of the data.
+func (obj tnefObject) inAttribute(err error) error {
+	err = addOffset(err, obj.Offset+tnefObjectHeaderLength)
+	switch e := err.(type) {
+	case *AttributeError:
+		e.Level, e.Name = obj.Level, obj.Name
+		return e
+	case *PropertyError:
+		return &AttributeError{Offset: e.Offset, Level: obj.Level, Name: obj.Name, Err: e}
+	}
+	return &AttributeError{Offset: obj.Offset, Level: obj.Level, Name: obj.Name, Err: err}
+}
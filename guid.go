@@ -0,0 +1,59 @@
+package tnef
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// GUID is a Windows GUID, as used for PT_CLSID values and the namespace of
+// named properties. It's stored in the mixed-endian order of the TNEF stream:
+// the first three fields are little endian, the last eight bytes are stored
+// as-is.
+type GUID [16]byte
+
+// ParseGUID parses a GUID in the usual notation, e.g.
+// "{00062008-0000-0000-C000-000000000046}". The braces are optional.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	t := strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	if len(t) != 36 || t[8] != '-' || t[13] != '-' || t[18] != '-' || t[23] != '-' {
+		return g, fmt.Errorf("tnef: invalid GUID %q", s)
+	}
+	b, err := hex.DecodeString(t[0:8] + t[9:13] + t[14:18] + t[19:23] + t[24:])
+	if err != nil {
+		return g, fmt.Errorf("tnef: invalid GUID %q", s)
+	}
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(b[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(b[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(b[6:8]))
+	copy(g[8:], b[8:])
+	return g, nil
+}
+
+// mustParseGUID is ParseGUID for well-known GUIDs; it panics if s is invalid.
+func mustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// String returns the GUID in the usual notation, e.g.
+// "{00062008-0000-0000-C000-000000000046}".
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:])
+}
+
+// decodeGUID returns the GUID in the 16 bytes of data.
+func decodeGUID(data []byte) GUID {
+	var g GUID
+	copy(g[:], data)
+	return g
+}
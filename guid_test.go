@@ -0,0 +1,52 @@
+package tnef
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGUID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			"{00062008-0000-0000-C000-000000000046}",
+			[]byte{0x08, 0x20, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
+			false,
+		},
+		{
+			"6ED8DA90-450B-101B-98DA-00AA003F1305",
+			[]byte{0x90, 0xda, 0xd8, 0x6e, 0x0b, 0x45, 0x1b, 0x10, 0x98, 0xda, 0x00, 0xaa, 0x00, 0x3f, 0x13, 0x05},
+			false,
+		},
+		{"{6ed8da90-450b-101b-98da-00aa003f1305}", nil, false},
+		{"{00062008-0000-0000-C000-00000000004}", nil, true},
+		{"{00062008+0000-0000-C000-000000000046}", nil, true},
+		{"{0006200X-0000-0000-C000-000000000046}", nil, true},
+		{"", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			g, err := ParseGUID(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wrong error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tt.want != nil && !bytes.Equal(g[:], tt.want) {
+				t.Errorf("wrong bytes\ngot:  % x\nwant: % x", g[:], tt.want)
+			}
+			if s, err := ParseGUID(g.String()); err != nil || s != g {
+				t.Errorf("String() = %q doesn't round trip", g.String())
+			}
+		})
+	}
+
+	if s := decodeGUID(tests[0].want).String(); s != tests[0].in {
+		t.Errorf("String() = %q; want %q", s, tests[0].in)
+	}
+}
@@ -0,0 +1,521 @@
+package tnef
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotMeeting is returned by EncodeICalendar for messages that aren't
+// appointments or meeting requests.
+var ErrNotMeeting = errors.New("tnef: not an appointment or meeting request")
+
+// Meeting methods, from the message class.
+var meetingMethods = []struct {
+	class    string
+	method   string
+	partstat string // of the sender of a response
+}{
+	{"IPM.Schedule.Meeting.Request", "REQUEST", ""},
+	{"IPM.Schedule.Meeting.Canceled", "CANCEL", ""},
+	{"IPM.Schedule.Meeting.Resp.Pos", "REPLY", "ACCEPTED"},
+	{"IPM.Schedule.Meeting.Resp.Tent", "REPLY", "TENTATIVE"},
+	{"IPM.Schedule.Meeting.Resp.Neg", "REPLY", "DECLINED"},
+	{"IPM.Appointment", "PUBLISH", ""},
+}
+
+// busyStatuses are the values of X-MICROSOFT-CDO-BUSYSTATUS for
+// PidLidBusyStatus.
+var busyStatuses = []string{"FREE", "TENTATIVE", "BUSY", "OOF", "WORKINGELSEWHERE"}
+
+// EncodeICalendar writes a meeting request, response or cancellation, or an
+// appointment, to w as an RFC 5545 iCalendar object with a single VEVENT, for
+// calendar clients that don't understand TNEF. It returns ErrNotMeeting for
+// other messages.
+//
+// The METHOD comes from the message class, the times and location from the
+// PSETID_Appointment named properties (or attDateStart and attDateEnd), and
+// the UID from PidLidGlobalObjectId. The organizer is the sender of a request,
+// and the recipients are the attendees; it's the other way around for a
+// response. A recurring meeting gets an RRULE and EXDATE from
+// PidLidAppointmentRecur, and a VEVENT for each modified instance; a pattern
+// that can't be decoded is left out. If the time zone of the organizer is
+// known, the times are in it, with a VTIMEZONE. Times from attDateStart and
+// attDateEnd are local times, so they're floating times otherwise.
+func EncodeICalendar(w io.Writer, d *Data) error {
+	class := string(d.MessageClass)
+	if s, ok := d.GetString(MAPIMessageClass); ok && class == "" {
+		class = s
+	}
+	var method, partstat string
+	for _, m := range meetingMethods {
+		if strings.EqualFold(class, m.class) || hasPrefixFold(class, m.class+".") {
+			method, partstat = m.method, m.partstat
+			break
+		}
+	}
+	if method == "" {
+		return ErrNotMeeting
+	}
+
+	start, end, floating := d.meetingTimes()
+	if start.IsZero() {
+		return ErrNotMeeting
+	}
+
+	rec, err := d.Recurrence()
+	if err != nil {
+		rec = nil
+	}
+	zone, err := d.TimeZone()
+	if err != nil {
+		zone = nil
+	}
+	// The times are in the time zone of the organizer if it's known, so the
+	// instances of a recurring meeting stay at the same local time across
+	// daylight saving time.
+	var tz icalZone
+	switch {
+	case zone != nil:
+		tz = icalZone{loc: zone.Location(), tzid: icalParam(zone.tzid())}
+		if floating {
+			start = inLocation(start, tz.loc)
+			if !end.IsZero() {
+				end = inLocation(end, tz.loc)
+			}
+		}
+	case floating:
+		tz = icalZone{loc: time.UTC, floating: true}
+	case rec != nil:
+		tz.loc = rec.location(start)
+	}
+
+	ic := icalWriter{w: bufio.NewWriter(w)}
+	ic.line("BEGIN", "VCALENDAR")
+	ic.line("PRODID", "-//teamwork//tnef//EN")
+	ic.line("VERSION", "2.0")
+	ic.line("METHOD", method)
+	if zone != nil {
+		ic.vtimezone(zone, start.In(tz.loc).Year())
+	}
+	ic.line("BEGIN", "VEVENT")
+	uid := d.meetingUID(start)
+	ic.line("UID", uid)
+	seq, hasSeq := d.namedInt32("PidLidAppointmentSequence")
+	if hasSeq {
+		ic.line("SEQUENCE", fmt.Sprint(seq))
+	}
+	stamp := icalTime(d.meetingStamp())
+	ic.line("DTSTAMP", stamp)
+
+	allDay, _ := d.namedBool("PidLidAppointmentSubType")
+	if allDay {
+		ic.line("DTSTART;VALUE=DATE", tz.date(start))
+		ic.line("DTEND;VALUE=DATE", tz.date(end))
+	} else {
+		ic.dateTime("DTSTART", tz, start)
+		if !end.IsZero() {
+			ic.dateTime("DTEND", tz, end)
+		}
+	}
+	if rec != nil {
+		ic.recurrence(rec, tz, allDay)
+	}
+
+	subject := d.subject()
+	if subject != "" {
+		ic.line("SUMMARY", icalText(subject))
+	}
+	location, _ := d.namedString("PidLidLocation")
+	if location == "" {
+		location, _ = d.namedString("PidLidWhere")
+	}
+	if location != "" {
+		ic.line("LOCATION", icalText(location))
+	}
+	if text := strings.TrimSpace(string(d.textBody())); text != "" {
+		ic.line("DESCRIPTION", icalText(text))
+	}
+
+	organizer, attendees := d.sender(), d.meetingAttendees()
+	if method == "REPLY" {
+		// The response goes from an attendee to the organizer.
+		var attendee *mail.Address
+		attendee, organizer = organizer, nil
+		if len(attendees) > 0 {
+			organizer = attendees[0].addr
+		}
+		attendees = nil
+		if attendee != nil {
+			attendees = append(attendees, icalAttendee{addr: attendee, partstat: partstat})
+		}
+	}
+	if organizer != nil {
+		ic.line("ORGANIZER"+icalCN(organizer.Name), "mailto:"+organizer.Address)
+	}
+	for _, a := range attendees {
+		if organizer != nil && strings.EqualFold(a.addr.Address, organizer.Address) {
+			continue
+		}
+		params := icalCN(a.addr.Name)
+		if a.role != "" {
+			params += ";ROLE=" + a.role
+		}
+		params += ";PARTSTAT=" + a.partstat
+		if a.rsvp {
+			params += ";RSVP=TRUE"
+		}
+		ic.line("ATTENDEE"+params, "mailto:"+a.addr.Address)
+	}
+
+	switch method {
+	case "REQUEST", "PUBLISH":
+		ic.line("STATUS", "CONFIRMED")
+	case "CANCEL":
+		ic.line("STATUS", "CANCELLED")
+	}
+	if private, _ := d.namedBool("PidLidPrivate"); private {
+		ic.line("CLASS", "PRIVATE")
+	}
+	busy, ok := d.namedInt32("PidLidBusyStatus")
+	if ok && busy >= 0 && int(busy) < len(busyStatuses) {
+		if busy == 0 {
+			ic.line("TRANSP", "TRANSPARENT")
+		} else {
+			ic.line("TRANSP", "OPAQUE")
+		}
+		ic.line("X-MICROSOFT-CDO-BUSYSTATUS", busyStatuses[busy])
+	}
+	if !d.CreationTime.IsZero() {
+		ic.line("CREATED", icalTime(d.CreationTime))
+	}
+	if !d.LastModificationTime.IsZero() {
+		ic.line("LAST-MODIFIED", icalTime(d.LastModificationTime))
+	}
+
+	if set, _ := d.namedBool("PidLidReminderSet"); set && method != "CANCEL" && method != "REPLY" {
+		delta, _ := d.namedInt32("PidLidReminderDelta")
+		ic.line("BEGIN", "VALARM")
+		ic.line("ACTION", "DISPLAY")
+		ic.line("DESCRIPTION", "Reminder")
+		ic.line("TRIGGER", fmt.Sprintf("-PT%dM", delta))
+		ic.line("END", "VALARM")
+	}
+
+	ic.line("END", "VEVENT")
+
+	// The modified instances of a recurring meeting are separate events with
+	// the same UID.
+	if rec != nil {
+		for _, e := range rec.Exceptions {
+			ic.line("BEGIN", "VEVENT")
+			ic.line("UID", uid)
+			if hasSeq {
+				ic.line("SEQUENCE", fmt.Sprint(seq))
+			}
+			ic.line("DTSTAMP", stamp)
+			if allDay {
+				ic.line("RECURRENCE-ID;VALUE=DATE", e.OriginalStart.Format("20060102"))
+			} else {
+				ic.dateTime("RECURRENCE-ID", tz, inLocation(e.OriginalStart, tz.loc))
+			}
+			if allDay || e.OverrideFlags&AROSubType != 0 && e.AllDay {
+				ic.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+				ic.line("DTEND;VALUE=DATE", e.End.Format("20060102"))
+			} else {
+				ic.dateTime("DTSTART", tz, inLocation(e.Start, tz.loc))
+				ic.dateTime("DTEND", tz, inLocation(e.End, tz.loc))
+			}
+			if e.OverrideFlags&AROSubject != 0 {
+				ic.line("SUMMARY", icalText(e.Subject))
+			} else if subject != "" {
+				ic.line("SUMMARY", icalText(subject))
+			}
+			if e.OverrideFlags&AROLocation != 0 {
+				ic.line("LOCATION", icalText(e.Location))
+			} else if location != "" {
+				ic.line("LOCATION", icalText(location))
+			}
+			ic.line("END", "VEVENT")
+		}
+	}
+
+	ic.line("END", "VCALENDAR")
+	return ic.w.Flush()
+}
+
+// recurrence writes the RRULE and EXDATE of a recurring meeting.
+func (ic icalWriter) recurrence(r *Recurrence, tz icalZone, allDay bool) {
+	var rule string
+	if allDay {
+		rule = r.rrule(r.EndDate.Format("20060102"))
+	} else if tz.floating {
+		rule = r.rrule(r.EndDate.Add(r.StartTimeOffset).Format("20060102T150405"))
+	} else {
+		rule = r.RRule(tz.loc)
+	}
+	if rule == "" {
+		return
+	}
+	ic.line("RRULE", rule)
+
+	if allDay {
+		var dates []string
+		for _, t := range r.deleted() {
+			dates = append(dates, t.Format("20060102"))
+		}
+		if len(dates) > 0 {
+			ic.line("EXDATE;VALUE=DATE", strings.Join(dates, ","))
+		}
+	} else if dates := r.ExDates(tz.loc); len(dates) > 0 {
+		ic.dateTime("EXDATE", tz, dates...)
+	}
+}
+
+// icalZone is the time zone of the times of an event. They're written in UTC
+// if there is no tzid, i.e. no VTIMEZONE, or as floating times if the time
+// zone isn't known.
+type icalZone struct {
+	loc      *time.Location
+	tzid     string
+	floating bool // loc is UTC, and the times are local times stored as UTC
+}
+
+// dateTime writes a DATE-TIME property with one or more values.
+func (ic icalWriter) dateTime(name string, tz icalZone, times ...time.Time) {
+	var values []string
+	for _, t := range times {
+		if tz.tzid == "" && !tz.floating {
+			values = append(values, icalTime(t))
+		} else {
+			values = append(values, t.In(tz.loc).Format("20060102T150405"))
+		}
+	}
+	if tz.tzid != "" {
+		name += ";TZID=" + tz.tzid
+	}
+	ic.line(name, strings.Join(values, ","))
+}
+
+// date returns the date of an all day event, which starts at midnight in the
+// time zone of the organizer.
+func (tz icalZone) date(t time.Time) string {
+	if tz.loc == nil {
+		return nearestDate(t)
+	}
+	return t.In(tz.loc).Format("20060102")
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// meetingTimes returns the start and end of the meeting, from the named
+// properties or attDateStart and attDateEnd. The attributes are the local time
+// of the organizer, stored as UTC; floating reports if that's what they are.
+func (d *Data) meetingTimes() (start, end time.Time, floating bool) {
+	start, ok := d.namedTime("PidLidAppointmentStartWhole")
+	if !ok {
+		return d.DateStart, d.DateEnd, true
+	}
+	end, ok = d.namedTime("PidLidAppointmentEndWhole")
+	if !ok && !d.DateStart.IsZero() && !d.DateEnd.IsZero() {
+		end = start.Add(d.DateEnd.Sub(d.DateStart))
+	}
+	return start, end, false
+}
+
+// meetingStamp returns when the message was sent, for DTSTAMP. attDateSent is
+// the last resort, as it's a local time rather than UTC.
+func (d *Data) meetingStamp() time.Time {
+	for _, t := range []time.Time{d.ClientSubmitTime, d.LastModificationTime, d.CreationTime, d.DateSent} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// globalObjectIDPrefix is the start of PidLidGlobalObjectId, followed by the
+// date of the instance, the creation time, 8 reserved bytes, and the size and
+// data of the id.
+var globalObjectIDPrefix = []byte{
+	0x04, 0x00, 0x00, 0x00, 0x82, 0x00, 0xe0, 0x00,
+	0x74, 0xc5, 0xb7, 0x10, 0x1a, 0x82, 0xe0, 0x08,
+}
+
+// meetingUID returns the UID of the meeting. It's the iCalendar UID stored in
+// the global object id if the meeting was created from iCalendar, or else the
+// id in hex with the instance date cleared, as in [MS-OXCICAL].
+func (d *Data) meetingUID(start time.Time) string {
+	id, ok := d.namedBinary("PidLidCleanGlobalObjectId")
+	if !ok {
+		id, ok = d.namedBinary("PidLidGlobalObjectId")
+	}
+	if ok && len(id) >= 40 && bytes.HasPrefix(id, globalObjectIDPrefix) {
+		size := byteToInt(id[36:40])
+		if data := id[40:]; size <= len(data) {
+			data = data[:size]
+			if vcal := []byte("vCal-Uid\x01\x00\x00\x00"); bytes.HasPrefix(data, vcal) {
+				return string(bytes.TrimRight(data[len(vcal):], "\x00"))
+			}
+		}
+		clean := append([]byte(nil), id...)
+		copy(clean[16:20], []byte{0, 0, 0, 0})
+		return strings.ToUpper(hex.EncodeToString(clean))
+	}
+
+	if d.MessageID != "" {
+		return d.MessageID
+	}
+	// There's no id, so make one up that doesn't change when the message
+	// is converted again.
+	sum := sha1.Sum([]byte(d.subject() + "\x00" + icalTime(start)))
+	return hex.EncodeToString(sum[:])
+}
+
+type icalAttendee struct {
+	addr     *mail.Address
+	role     string
+	partstat string
+	rsvp     bool
+}
+
+// meetingAttendees returns the recipients of the message as attendees;
+// resources in Bcc aren't participants.
+func (d *Data) meetingAttendees() []icalAttendee {
+	rsvp, _ := d.GetBool(MAPIResponseRequested)
+	var attendees []icalAttendee
+	for _, r := range d.Recipients {
+		addr := mailAddress(r.Address, r.Properties.getString(MAPISmtpAddress))
+		if addr == nil {
+			continue
+		}
+		a := icalAttendee{addr: addr, partstat: "NEEDS-ACTION", rsvp: rsvp}
+		switch r.Type {
+		case RecipientTo:
+			a.role = "REQ-PARTICIPANT"
+		case RecipientCc:
+			a.role = "OPT-PARTICIPANT"
+		case RecipientBcc:
+			a.role, a.rsvp = "NON-PARTICIPANT", false
+		}
+		attendees = append(attendees, a)
+	}
+	return attendees
+}
+
+// icalWriter writes content lines, folded at 75 octets.
+type icalWriter struct {
+	w *bufio.Writer
+}
+
+func (ic icalWriter) line(name, value string) {
+	s := name + ":" + value
+	max := 75
+	for len(s) > max {
+		n := max
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		ic.w.WriteString(s[:n] + "\r\n ")
+		s = s[n:]
+		max = 74 // after the space
+	}
+	ic.w.WriteString(s + "\r\n")
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// nearestDate returns the date of the nearest midnight in UTC, for all day
+// events and birthdays when the time zone they were created in isn't known.
+func nearestDate(t time.Time) string {
+	return t.UTC().Add(12 * time.Hour).Truncate(24 * time.Hour).Format("20060102")
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// icalCN returns the CN parameter for a name, or "" if there is no name.
+func icalCN(name string) string {
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+// EncodeVTimezone writes the rule of the time zone for year as an iCalendar
+// VTIMEZONE component, with the name as TZID.
+func (z *TimeZone) EncodeVTimezone(w io.Writer, year int) error {
+	ic := icalWriter{w: bufio.NewWriter(w)}
+	ic.vtimezone(z, year)
+	return ic.w.Flush()
+}
+
+func (ic icalWriter) vtimezone(z *TimeZone, year int) {
+	r := z.rule(year)
+	ic.line("BEGIN", "VTIMEZONE")
+	ic.line("TZID", icalText(z.tzid()))
+	if !r.hasDaylight() {
+		ic.line("BEGIN", "STANDARD")
+		ic.line("DTSTART", "16010101T000000")
+		ic.line("TZOFFSETFROM", icalOffset(r.standard()))
+		ic.line("TZOFFSETTO", icalOffset(r.standard()))
+		ic.line("END", "STANDARD")
+	} else {
+		ic.observance("STANDARD", r.StandardDate, r.daylight(), r.standard())
+		ic.observance("DAYLIGHT", r.DaylightDate, r.standard(), r.daylight())
+	}
+	ic.line("END", "VTIMEZONE")
+}
+
+// observance writes a STANDARD or DAYLIGHT component that starts at st.
+func (ic icalWriter) observance(name string, st SystemTime, from, to int) {
+	year := 1601
+	if st.Year != 0 {
+		year = int(st.Year)
+	}
+	start, _ := st.local(year)
+	ic.line("BEGIN", name)
+	ic.line("DTSTART", start.Format("20060102T150405"))
+	if st.Year == 0 {
+		n := strconv.Itoa(int(st.Day))
+		if st.Day >= 5 {
+			n = "-1"
+		}
+		ic.line("RRULE", "FREQ=YEARLY;BYDAY="+n+rruleDays[st.DayOfWeek%7]+";BYMONTH="+strconv.Itoa(int(st.Month)))
+	}
+	ic.line("TZOFFSETFROM", icalOffset(from))
+	ic.line("TZOFFSETTO", icalOffset(to))
+	ic.line("END", name)
+}
+
+// icalOffset returns a UTC-OFFSET value, e.g. "+0100".
+func icalOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// icalParam quotes a parameter value if it has to be.
+func icalParam(s string) string {
+	if strings.ContainsAny(s, `:;,"`) {
+		return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+	}
+	return s
+}
@@ -0,0 +1,332 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedProps creates named properties from pairs of registered names and
+// values.
+func namedProps(t *testing.T, pairs ...interface{}) []*Property {
+	t.Helper()
+	var props []*Property
+	for i := 0; i < len(pairs); i += 2 {
+		name := pairs[i].(string)
+		np, ok := LookupNamedProperty(name)
+		if !ok {
+			t.Fatalf("unknown named property %q", name)
+		}
+		var typ uint16
+		switch pairs[i+1].(type) {
+		case string:
+			typ = szmapiUnicodeString
+		case int32:
+			typ = szmapiInt
+		case bool:
+			typ = szmapiBoolean
+		case time.Time:
+			typ = szmapiSystime
+		case []byte:
+			typ = szmapiBinary
+		}
+		props = append(props, &Property{
+			TagType: typ, TagId: uint16(0x8000 + i/2),
+			PropNameSpace: np.Set, PropMap: le32(int(np.ID)),
+			Data: pairs[i+1],
+		})
+	}
+	return props
+}
+
+// globalObjectID returns a PidLidGlobalObjectId with the given data.
+func globalObjectID(instance []byte, data []byte) []byte {
+	id := append([]byte(nil), globalObjectIDPrefix...)
+	id = append(id, instance...)
+	id = append(id, make([]byte, 16)...) // creation time and reserved
+	id = append(id, le32(len(data))...)
+	return append(id, data...)
+}
+
+func TestEncodeICalendar(t *testing.T) {
+	start := time.Date(2018, 11, 6, 15, 0, 0, 0, time.UTC)
+	organizer := Address{DisplayName: "Organizer", AddressType: "SMTP", EmailAddress: "organizer@example.com"}
+	recipients := []Recipient{
+		{Address: Address{DisplayName: "Attendee, First", AddressType: "SMTP", EmailAddress: "first@example.com"}, Type: RecipientTo},
+		{Address: Address{DisplayName: "Second", AddressType: "SMTP", EmailAddress: "second@example.com"}, Type: RecipientCc},
+		{Address: Address{DisplayName: "Room", AddressType: "SMTP", EmailAddress: "room@example.com"}, Type: RecipientBcc},
+	}
+	meeting := func(class string, props ...*Property) *Data {
+		props = append(props, namedProps(t,
+			"PidLidAppointmentStartWhole", start,
+			"PidLidAppointmentEndWhole", start.Add(90*time.Minute),
+			"PidLidLocation", "Room 1; second floor",
+			"PidLidAppointmentSequence", int32(2),
+			"PidLidBusyStatus", int32(2),
+			"PidLidGlobalObjectId", globalObjectID([]byte{0x07, 0xe2, 0x0b, 0x06}, []byte{1, 2, 3}),
+		)...)
+		props = append(props, &Property{TagType: szmapiBoolean, TagId: MAPIResponseRequested, Data: true})
+		return &Data{
+			MessageClass: []byte(class),
+			From:         organizer,
+			Subject:      "Planning",
+			DateSent:     start.Add(-time.Hour),
+			Body:         []byte("Let's plan.\r\nBring notes."),
+			Recipients:   recipients,
+			Properties:   MsgPropertyList{Values: props},
+		}
+	}
+	recur := recurPattern(&Recurrence{
+		Frequency: RecurWeekly, PatternType: PatternWeek, Period: 1, DayOfWeek: 0x04,
+		EndType: RecurEndAfterDate, OccurrenceCount: 4,
+		DeletedInstanceDates: []time.Time{
+			time.Date(2018, 11, 13, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 11, 20, 0, 0, 0, 0, time.UTC),
+		},
+		ModifiedInstanceDates: []time.Time{time.Date(2018, 11, 21, 0, 0, 0, 0, time.UTC)},
+		StartDate:             time.Date(2018, 11, 6, 0, 0, 0, 0, time.UTC),
+		EndDate:               time.Date(2018, 11, 27, 0, 0, 0, 0, time.UTC),
+		StartTimeOffset:       16 * time.Hour,
+		EndTimeOffset:         17*time.Hour + 30*time.Minute,
+		Exceptions: []RecurrenceException{{
+			Start:         time.Date(2018, 11, 21, 16, 0, 0, 0, time.UTC),
+			End:           time.Date(2018, 11, 21, 17, 30, 0, 0, time.UTC),
+			OriginalStart: time.Date(2018, 11, 20, 16, 0, 0, 0, time.UTC),
+			OverrideFlags: AROSubject,
+			Subject:       "Moved",
+		}},
+	})
+	uid := "040000008200E00074C5B7101A82E008" + "00000000" + strings.Repeat("00", 16) + "03000000" + "010203"
+
+	tests := []struct {
+		name string
+		in   *Data
+		want []string
+	}{
+		{
+			"request",
+			meeting("IPM.Schedule.Meeting.Request"),
+			[]string{
+				"METHOD:REQUEST",
+				"UID:" + uid,
+				"SEQUENCE:2",
+				"DTSTAMP:20181106T140000Z",
+				"DTSTART:20181106T150000Z",
+				"DTEND:20181106T163000Z",
+				"SUMMARY:Planning",
+				`LOCATION:Room 1\; second floor`,
+				`DESCRIPTION:Let's plan.\nBring notes.`,
+				`ORGANIZER;CN="Organizer":mailto:organizer@example.com`,
+				`ATTENDEE;CN="Attendee, First";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:first@example.com`,
+				`ATTENDEE;CN="Second";ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:second@example.com`,
+				`ATTENDEE;CN="Room";ROLE=NON-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:room@example.com`,
+				"STATUS:CONFIRMED",
+				"TRANSP:OPAQUE",
+				"X-MICROSOFT-CDO-BUSYSTATUS:BUSY",
+			},
+		},
+		{
+			"cancel",
+			meeting("IPM.Schedule.Meeting.Canceled"),
+			[]string{"METHOD:CANCEL", "UID:" + uid, "STATUS:CANCELLED"},
+		},
+		{
+			"reply",
+			meeting("IPM.Schedule.Meeting.Resp.Tent"),
+			[]string{
+				"METHOD:REPLY",
+				`ORGANIZER;CN="Attendee, First":mailto:first@example.com`,
+				`ATTENDEE;CN="Organizer";PARTSTAT=TENTATIVE:mailto:organizer@example.com`,
+			},
+		},
+		{
+			"iCalendar UID",
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t,
+				"PidLidCleanGlobalObjectId", globalObjectID(make([]byte, 4), []byte("vCal-Uid\x01\x00\x00\x00abc@example.com\x00")),
+			)...),
+			[]string{"UID:abc@example.com"},
+		},
+		{
+			"all day",
+			// Midnight in UTC+1.
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t,
+				"PidLidAppointmentSubType", true,
+				"PidLidAppointmentStartWhole", time.Date(2018, 11, 5, 23, 0, 0, 0, time.UTC),
+				"PidLidAppointmentEndWhole", time.Date(2018, 11, 6, 23, 0, 0, 0, time.UTC),
+			)...),
+			[]string{"DTSTART;VALUE=DATE:20181106", "DTEND;VALUE=DATE:20181107"},
+		},
+		{
+			"recurring",
+			// Weekly at 16:00 in UTC+1, with one instance deleted and one
+			// moved a day later.
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t, "PidLidAppointmentRecur", recur)...),
+			[]string{
+				"DTSTART:20181106T150000Z",
+				"RRULE:FREQ=WEEKLY;UNTIL=20181127T150000Z;BYDAY=TU;WKST=SU",
+				"EXDATE:20181113T150000Z",
+				"RECURRENCE-ID:20181120T150000Z",
+				"DTSTART:20181121T150000Z",
+				"DTEND:20181121T163000Z",
+				"SUMMARY:Moved",
+			},
+		},
+		{
+			"time zone",
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t,
+				"PidLidAppointmentRecur", recur,
+				"PidLidAppointmentTimeZoneDefinitionStartDisplay", tzDefinition("W. Europe Standard Time", westEurope),
+			)...),
+			[]string{
+				"TZID:W. Europe Standard Time",
+				"TZOFFSETTO:+0200",
+				"DTSTART;TZID=W. Europe Standard Time:20181106T160000",
+				"DTEND;TZID=W. Europe Standard Time:20181106T173000",
+				"RRULE:FREQ=WEEKLY;UNTIL=20181127T150000Z;BYDAY=TU;WKST=SU",
+				"EXDATE;TZID=W. Europe Standard Time:20181113T160000",
+				"RECURRENCE-ID;TZID=W. Europe Standard Time:20181120T160000",
+				"DTSTART;TZID=W. Europe Standard Time:20181121T160000",
+			},
+		},
+		{
+			"time zone struct",
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t,
+				"PidLidTimeZoneStruct", append(append(make([]byte, 14), systemTime(SystemTime{})...), make([]byte, 18)...),
+				"PidLidTimeZoneDescription", "(UTC) Dublin, Edinburgh, Lisbon, London",
+			)...),
+			[]string{
+				`TZID:(UTC) Dublin\, Edinburgh\, Lisbon\, London`,
+				"DTSTART:16010101T000000",
+				`DTSTART;TZID="(UTC) Dublin, Edinburgh, Lisbon, London":20181106T150000`,
+			},
+		},
+		{
+			"all day in a time zone",
+			// Midnight in UTC+5, which isn't the nearest in UTC.
+			meeting("IPM.Schedule.Meeting.Request", namedProps(t,
+				"PidLidAppointmentSubType", true,
+				"PidLidAppointmentStartWhole", time.Date(2018, 11, 5, 19, 0, 0, 0, time.UTC),
+				"PidLidAppointmentEndWhole", time.Date(2018, 11, 6, 19, 0, 0, 0, time.UTC),
+				"PidLidAppointmentTimeZoneDefinitionStartDisplay", tzDefinition("West Asia Standard Time", TimeZoneRule{Bias: -300}),
+			)...),
+			[]string{"DTSTART;VALUE=DATE:20181106", "DTEND;VALUE=DATE:20181107"},
+		},
+		{
+			"attributes",
+			&Data{
+				MessageClass: []byte("IPM.Schedule.Meeting.Request"),
+				MessageID:    "1234",
+				DateStart:    start,
+				DateEnd:      start.Add(time.Hour),
+			},
+			// The local time of the organizer, in an unknown time zone.
+			[]string{"UID:1234", "DTSTART:20181106T150000", "DTEND:20181106T160000"},
+		},
+		{
+			"attributes in a time zone",
+			&Data{
+				MessageClass: []byte("IPM.Schedule.Meeting.Request"),
+				MessageID:    "1234",
+				DateStart:    start,
+				DateEnd:      start.Add(time.Hour),
+				Properties: MsgPropertyList{Values: namedProps(t,
+					"PidLidAppointmentTimeZoneDefinitionStartDisplay", tzDefinition("West Asia Standard Time", TimeZoneRule{Bias: -300}),
+				)},
+			},
+			[]string{
+				"DTSTART;TZID=West Asia Standard Time:20181106T150000",
+				"DTEND;TZID=West Asia Standard Time:20181106T160000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Go through Encode, to check the named properties are
+			// decoded as expected.
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.in); err != nil {
+				t.Fatal(err)
+			}
+			d, err := Decode(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf.Reset()
+			if err := EncodeICalendar(&buf, d); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(out, "END:VEVENT\r\nEND:VCALENDAR\r\n") {
+				t.Errorf("not a VCALENDAR:\n%s", out)
+			}
+			for _, l := range strings.Split(out, "\r\n") {
+				if len(l) > 75 {
+					t.Errorf("line is longer than 75 octets: %q", l)
+				}
+			}
+			lines := strings.Split(strings.ReplaceAll(out, "\r\n ", ""), "\r\n")
+			for _, want := range tt.want {
+				if !inStringSlice(lines, want) {
+					t.Errorf("no line %q in:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeICalendarAppointment(t *testing.T) {
+	d, err := Decode(read(t, "./testdata", "triples.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeICalendar(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//teamwork//tnef//EN",
+		"VERSION:2.0",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:C326F5735704184D96EBD387444C618B",
+		"SEQUENCE:0",
+		"DTSTAMP:20030523T132617Z",
+		"DTSTART:20030523T140000Z",
+		"DTEND:20030523T150000Z",
+		"SUMMARY:Sample Summary",
+		"LOCATION:Sample Location",
+		"DESCRIPTION:Sample description",
+		`ORGANIZER;CN="Martin Rakhmanoff":mailto:rakhmanoff@sundance.spb.ru`,
+		"STATUS:CONFIRMED",
+		"TRANSP:OPAQUE",
+		"X-MICROSOFT-CDO-BUSYSTATUS:OOF",
+		"CREATED:20030523T132539Z",
+		"LAST-MODIFIED:20030523T132636Z",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"DESCRIPTION:Reminder",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if got := buf.String(); got != want {
+		t.Errorf("wrong output\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEncodeICalendarNotMeeting(t *testing.T) {
+	d, err := Decode(read(t, "./testdata", "two-files.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeICalendar(&bytes.Buffer{}, d); !errors.Is(err, ErrNotMeeting) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
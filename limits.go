@@ -0,0 +1,108 @@
+package tnef
+
+import "fmt"
+
+// Limits restricts how much a TNEF stream can make the decoder allocate, to
+// protect against corrupt or malicious files. Decoding stops with an error
+// that wraps ErrLimitExceeded if a limit is exceeded, also in recovery mode.
+//
+// A zero field means the value from DefaultLimits. The limits apply to the
+// stream as a whole, including the messages embedded in it.
+type Limits struct {
+	// MaxAttachments is the number of attachments.
+	MaxAttachments int
+
+	// MaxProperties is the number of MAPI properties in a property list,
+	// e.g. the properties of the message or of an attachment.
+	MaxProperties int
+
+	// MaxMultiValues is the number of values of a multi-valued MAPI
+	// property.
+	MaxMultiValues int
+
+	// MaxOutputBytes is the total size of the attribute data and
+	// decompressed RTF bodies.
+	MaxOutputBytes int
+
+	// MaxRTFSize is the size of a decompressed RTF body.
+	MaxRTFSize int
+
+	// MaxEmbeddedDepth is how deep messages can be embedded in
+	// attachments. A negative value disables decoding embedded messages;
+	// they're only available in the attachment properties.
+	MaxEmbeddedDepth int
+}
+
+// DefaultLimits are the limits used for the zero fields of Limits.
+var DefaultLimits = Limits{
+	MaxAttachments:   10000,
+	MaxProperties:    100000,
+	MaxMultiValues:   100000,
+	MaxOutputBytes:   1 << 30,
+	MaxRTFSize:       100 << 20,
+	MaxEmbeddedDepth: 10,
+}
+
+// withDefaults returns l with the zero fields set to the default.
+func (l Limits) withDefaults() Limits {
+	set := func(v *int, def int) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	set(&l.MaxAttachments, DefaultLimits.MaxAttachments)
+	set(&l.MaxProperties, DefaultLimits.MaxProperties)
+	set(&l.MaxMultiValues, DefaultLimits.MaxMultiValues)
+	set(&l.MaxOutputBytes, DefaultLimits.MaxOutputBytes)
+	set(&l.MaxRTFSize, DefaultLimits.MaxRTFSize)
+	set(&l.MaxEmbeddedDepth, DefaultLimits.MaxEmbeddedDepth)
+	return l
+}
+
+// limiter keeps track of the limits while decoding a stream.
+type limiter struct {
+	Limits
+	attachments int
+	output      int
+}
+
+func newLimiter(l Limits) *limiter {
+	return &limiter{Limits: l.withDefaults()}
+}
+
+func limitError(what string, max int) error {
+	return fmt.Errorf("more than %d %s: %w", max, what, ErrLimitExceeded)
+}
+
+// addAttachment counts a new attachment.
+func (l *limiter) addAttachment() error {
+	l.attachments++
+	if l.attachments > l.MaxAttachments {
+		return limitError("attachments", l.MaxAttachments)
+	}
+	return nil
+}
+
+// addOutput counts n bytes of output.
+func (l *limiter) addOutput(n int) error {
+	l.output += n
+	if l.output > l.MaxOutputBytes {
+		return limitError("bytes of output", l.MaxOutputBytes)
+	}
+	return nil
+}
+
+// addAttribute counts the n bytes of data of an attribute as output.
+func (l *limiter) addAttribute(obj tnefObject, n int) error {
+	if err := l.addOutput(n); err != nil {
+		return obj.inAttribute(err)
+	}
+	return nil
+}
+
+func (l *limiter) checkProperties(n int) error {
+	if n > l.MaxProperties {
+		return limitError("properties", l.MaxProperties)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	signature := []byte{0x78, 0x9f, 0x3e, 0x22, 0, 0}
+	multiValue := []byte{
+		1, 0, 0, 0, // count
+		0x03, 0x10, 0x00, 0x80, // named MV int32 property
+		0x29, 0x03, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46, // PS_PUBLIC_STRINGS
+		0, 0, 0, 0, // kind: id
+		1, 0, 0, 0, // id
+		3, 0, 0, 0, // 3 values
+		1, 0, 0, 0,
+		2, 0, 0, 0,
+		3, 0, 0, 0,
+	}
+
+	tests := []struct {
+		name   string
+		in     []byte
+		limits Limits
+	}{
+		{"attachments", read(t, "./testdata", "two-files.tnef"), Limits{MaxAttachments: 1}},
+		{"properties", read(t, "./testdata", "two-files.tnef"), Limits{MaxProperties: 10}},
+		{"output", read(t, "./testdata", "two-files.tnef"), Limits{MaxOutputBytes: 1000}},
+		{"RTF", read(t, "./testdata", "rtf.tnef"), Limits{MaxRTFSize: 100}},
+		{
+			"message values",
+			append(signature, tnefAttr(lvlMessage, ATTMAPIPROPS, 0x0006, multiValue)...),
+			Limits{MaxMultiValues: 2},
+		},
+		{
+			"attachment values",
+			bytes.Join([][]byte{
+				signature,
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0006, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHMENT, 0x0006, multiValue),
+			}, nil),
+			Limits{MaxMultiValues: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.in); err != nil {
+				t.Fatalf("error with the default limits: %v", err)
+			}
+
+			o := DecodeOptions{Limits: tt.limits}
+			decoders := map[string]func() error{
+				"Decode": func() error {
+					_, err := o.Decode(tt.in)
+					return err
+				},
+				"DecodeReader": func() error {
+					_, err := o.DecodeReader(bytes.NewReader(tt.in))
+					return err
+				},
+				"Recover": func() error {
+					_, err := DecodeOptions{Limits: tt.limits, Recover: true}.Decode(tt.in)
+					return err
+				},
+				"NextAttachment": func() error {
+					d := o.NewDecoder(bytes.NewReader(tt.in))
+					for d.NextAttachment() {
+						if _, err := io.Copy(io.Discard, d.Attachment().Open()); err != nil {
+							return err
+						}
+					}
+					return d.Err()
+				},
+			}
+			for name, decode := range decoders {
+				err := decode()
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("%s: wrong error: %v", name, err)
+				}
+				var attrErr *AttributeError
+				if !errors.As(err, &attrErr) {
+					t.Errorf("%s: not an AttributeError: %#v", name, err)
+				}
+			}
+		})
+	}
+}
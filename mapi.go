@@ -1,10 +1,12 @@
 package tnef
 
-import "fmt"
+import "bytes"
 
 // MAPIAttribute contains MAPI format attributes, i.e encoding type
 // headers, attachments etc. See the constants for
 // code references to find specific attributes.
+//
+// Deprecated: use Property, which has the decoded value.
 type MAPIAttribute struct {
 	Type int
 	Name int
@@ -12,91 +14,69 @@ type MAPIAttribute struct {
 	GUID int
 }
 
-func decodeMapi(data []byte) ([]MAPIAttribute, error) {
+// mapiAttributes returns the properties in l as MAPIAttributes. Data is the
+// stored value, or the values one after the other for multi-valued
+// properties; named properties have the id and GUID of their name.
+func mapiAttributes(l MsgPropertyList) []MAPIAttribute {
 	var attrs []MAPIAttribute
-	dataLen := len(data)
-	offset := 0
-	numProperties := byteToInt(data[offset : offset+4])
-	offset += 4
-
-	for i := 0; i < numProperties; i++ {
-		if offset >= dataLen {
-			continue
-		}
-
-		attrType := byteToInt(data[offset : offset+2])
-		offset += 2
-
-		isMultiValue := (attrType & mvFlag) != 0
-		attrType &= ^mvFlag // Remove mvFlag
-
-		typeSize := getTypeSize(attrType)
-		if typeSize < 0 {
-			isMultiValue = true
-		}
-
-		attrName := byteToInt(data[offset : offset+2])
-		offset += 2
-
-		guid := 0
-		if attrName >= 0x8000 && attrName <= 0xFFFE {
-			guid = byteToInt(data[offset : offset+16])
-			offset += 16
-			kind := byteToInt(data[offset : offset+4])
-			offset += 4
-
-			if kind == 0 {
-				attrName = byteToInt(data[offset : offset+4])
-				offset += 4
-			} else if kind == 1 {
-				iidLen := byteToInt(data[offset : offset+4])
-				offset += 4
-
-				offset += iidLen
-
-				offset += (-iidLen & 3)
+	for _, v := range l.Values {
+		attr := MAPIAttribute{Type: int(v.TagType &^ mvFlag), Name: int(v.TagId), Data: v.Raw}
+		if v.TagId >= 0x8000 {
+			attr.GUID = byteToInt(v.PropNameSpace[:])
+			if v.PropIDType == 0 && len(v.PropMap) == 4 {
+				attr.Name = byteToInt(v.PropMap)
 			}
 		}
-
-		// Handle multi-value properties
-		valueCount := 1
-		if isMultiValue {
-			valueCount = byteToInt(data[offset : offset+4])
-			offset += 4
+		if v.TagType&mvFlag != 0 {
+			attr.Data = multiValueData(v)
 		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
 
-		if valueCount > 1024 && valueCount > len(data) {
-			return nil, fmt.Errorf("count is too large: %d", valueCount)
+// multiValueData returns the values of a multi-valued property one after the
+// other, without the counts, lengths and padding.
+func multiValueData(v *Property) []byte {
+	// Encode the value without the name of a named property.
+	p := *v
+	p.TagId = 0
+	var buf bytes.Buffer
+	if err := encodeMsgPropertyValue(&buf, &p, 0); err != nil {
+		return nil
+	}
+	c := &leCursor{data: buf.Bytes()[4:]}
+	size := getTypeSize(int(v.TagType &^ mvFlag))
+	var data []byte
+	for n := c.uint32(); n > 0 && !c.err; n-- {
+		length := size
+		if size < 0 {
+			length = int(c.uint32())
 		}
-
-		attrData := []byte{}
-
-		for i := 0; i < valueCount; i++ {
-			length := typeSize
-			if typeSize < 0 {
-				length = byteToInt(data[offset : offset+4])
-				offset += 4
-			}
-
-			// Read the data in
-			// the original python code doesn't fail if it tries to
-			// read beyond the slice end, but go panics - mimic the
-			// python code
-			end := offset + length
-			if end >= len(data) {
-				attrData = append(attrData, data[offset:]...)
-			} else {
-				attrData = append(attrData, data[offset:offset+length]...)
-			}
-
-			offset += length
-			offset += (-length & 3)
+		data = append(data, c.next(length)...)
+		if size < 0 {
+			c.pad(length)
 		}
-
-		attrs = append(attrs, MAPIAttribute{Type: attrType, Name: attrName, Data: attrData, GUID: guid})
 	}
+	return data
+}
 
-	return attrs, nil
+// rawValue returns the stored value of a single valued property from its
+// MsgPropertyData.
+func rawValue(typ uint16, data []byte) []byte {
+	if typ&mvFlag != 0 {
+		return nil
+	}
+	if size := getTypeSize(int(typ)); size > 0 {
+		return data[:size]
+	}
+	// Variable length values are stored as a count, which should be 1, and
+	// the length of each value.
+	if len(data) < 8 || byteToInt(data[0:4]) == 0 {
+		return nil
+	}
+	n := byteToInt(data[4:8])
+	return data[8 : 8+n]
 }
 
 func getTypeSize(attrType int) int {
@@ -139,9 +119,19 @@ const (
 	//szmapiUnknown = 0x0033
 )
 
+// Values of the MAPIAttachMethod property of an attachment.
+const (
+	AttachByValue      = 0x0001
+	AttachByReference  = 0x0002
+	AttachByRefResolve = 0x0003
+	AttachByRefOnly    = 0x0004
+	AttachEmbeddedMsg  = 0x0005
+	AttachOLE          = 0x0006
+)
+
 // We can use these constants to find specific types
-// of MAPIAttribute by comparing it to the type of the
-// attribute.
+// of Property by comparing it to the TagId of the
+// property.
 const (
 	MAPIAcknowledgementMode                   = 0x0001
 	MAPIAlternateRecipientAllowed             = 0x0002
@@ -264,6 +254,7 @@ const (
 	MAPITnefCorrelationKey                    = 0x007F
 	MAPIBody                                  = 0x1000
 	MAPIBodyHTML                              = 0x1013
+	MAPIInternetMessageID                     = 0x1035
 	MAPIReportText                            = 0x1001
 	MAPIOriginatorAndDlExpansionHistory       = 0x1002
 	MAPIReportingDlName                       = 0x1003
@@ -436,6 +427,7 @@ const (
 	MAPIDisplayType                           = 0x3900
 	MAPITemplateID                            = 0x3902
 	MAPIPrimaryCapability                     = 0x3904
+	MAPISmtpAddress                           = 0x39FE
 	MAPI7bitDisplayName                       = 0x39FF
 	MAPIAccount                               = 0x3A00
 	MAPIAlternateRecipient                    = 0x3A01
@@ -564,8 +556,12 @@ const (
 	MAPIYpos                                  = 0x3F06
 	MAPIControlID                             = 0x3F07
 	MAPIInitialDetailsPane                    = 0x3F08
+	MAPIInternetCodepage                      = 0x3FDE
+	MAPIMessageCodepage                       = 0x3FFD
+	MAPISenderSmtpAddress                     = 0x5D01
 	MAPIIdSecureMin                           = 0x67F0
 	MAPIIdSecureMax                           = 0x67FF
 
-	MAPITagAttachmentHidden = 0x7FFE
+	MAPITagAttachmentHidden       = 0x7FFE
+	MAPITagAttachmentContactPhoto = 0x7FFF
 )
@@ -0,0 +1,220 @@
+package tnef
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// Priority is the priority of a message, from the attPriority attribute.
+type Priority int
+
+// Possible values for Priority. The zero value means the message didn't
+// specify a priority.
+const (
+	PriorityHigh   Priority = 1
+	PriorityNormal Priority = 2
+	PriorityLow    Priority = 3
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	}
+	return ""
+}
+
+// MessageStatus contains the flags from the attMessageStatus attribute.
+type MessageStatus uint8
+
+// Flags for MessageStatus.
+const (
+	MessageStatusModified  MessageStatus = 0x01
+	MessageStatusLocal     MessageStatus = 0x02
+	MessageStatusSubmitted MessageStatus = 0x04
+	MessageStatusRead      MessageStatus = 0x20
+	MessageStatusHasAttach MessageStatus = 0x80
+)
+
+// Address is an e-mail address with a display name.
+type Address struct {
+	DisplayName  string
+	AddressType  string // e.g. "SMTP" or "EX"
+	EmailAddress string
+}
+
+// RecipientType tells if a recipient is in the To, Cc or Bcc of a message.
+type RecipientType int
+
+// Possible values for RecipientType, from the MAPIRecipientType property.
+const (
+	RecipientTo  RecipientType = 1
+	RecipientCc  RecipientType = 2
+	RecipientBcc RecipientType = 3
+)
+
+func (t RecipientType) String() string {
+	switch t {
+	case RecipientTo:
+		return "To"
+	case RecipientCc:
+		return "Cc"
+	case RecipientBcc:
+		return "Bcc"
+	}
+	return ""
+}
+
+// Recipient is a row from the recipient table (attRecipTable) of a message.
+type Recipient struct {
+	Address
+	Type       RecipientType
+	Properties MsgPropertyList
+}
+
+/**
+ * RecipientTable = RecipientCount *RecipientRow
+ * RecipientCount = UINT32
+ * RecipientRow = MsgPropertyList
+ */
+func decodeRecipientTable(data []byte, l *limiter, cp int) ([]Recipient, error) {
+	if len(data) < 4 {
+		return nil, &AttributeError{Err: ErrTruncated}
+	}
+	count := byteToInt(data[0:4])
+	offset := 4
+
+	recipients := []Recipient{}
+	for i := 0; i < count && offset < len(data); i++ {
+		props, n, err := decodeMsgProperties(data[offset:], l)
+		if err != nil {
+			return nil, addOffset(err, offset)
+		}
+		offset += n
+		props.decodeStrings(cp)
+
+		r := Recipient{
+			Address: Address{
+				DisplayName:  props.getString(MAPIDisplayName),
+				AddressType:  props.getString(MAPIAddrtype),
+				EmailAddress: props.getString(MAPIEmailAddress),
+			},
+			Properties: props,
+		}
+		if t, ok := props.GetInt32(MAPIRecipientType); ok {
+			r.Type = RecipientType(t)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// addMessageAttr stores the value of a message level attribute in the
+// corresponding field of Data.
+func (tnef *Data) addMessageAttr(obj tnefObject) {
+	switch obj.Name {
+	case ATTFROM:
+		tnef.From = decodeTRP(obj.Data)
+		tnef.From.DisplayName = decodeString8(tnef.OEMCodePage, tnef.From.DisplayName)
+	case ATTSUBJECT:
+		tnef.Subject = decodeString8(tnef.OEMCodePage, decodeAttrString(obj.Data))
+	case ATTDATESENT:
+		tnef.DateSent = decodeAttrDate(obj.Data)
+	case ATTDATERECD:
+		tnef.DateReceived = decodeAttrDate(obj.Data)
+	case ATTDATEMODIFY:
+		tnef.DateModified = decodeAttrDate(obj.Data)
+	case ATTDATESTART:
+		tnef.DateStart = decodeAttrDate(obj.Data)
+	case ATTDATEEND:
+		tnef.DateEnd = decodeAttrDate(obj.Data)
+	case ATTMESSAGESTATUS:
+		if len(obj.Data) > 0 {
+			tnef.MessageStatus = MessageStatus(obj.Data[0])
+		}
+	case ATTMESSAGEID:
+		tnef.MessageID = decodeAttrString(obj.Data)
+	case ATTPARENTID:
+		tnef.ParentID = decodeAttrString(obj.Data)
+	case ATTCONVERSATIONID:
+		tnef.ConversationID = decodeAttrString(obj.Data)
+	case ATTPRIORITY:
+		if len(obj.Data) >= 2 {
+			tnef.Priority = Priority(byteToInt(obj.Data[0:2]))
+		}
+	case ATTBODY:
+		// The body from the MAPI properties takes precedence.
+		if tnef.Body == nil {
+			tnef.Body = []byte(decodeString8(tnef.OEMCodePage, string(bytes.TrimRight(obj.Data, "\x00"))))
+		}
+	case ATTTNEFVERSION:
+		if len(obj.Data) >= 4 {
+			tnef.TNEFVersion = uint32(byteToInt(obj.Data[0:4]))
+		}
+	default:
+		//fmt.Printf("TNEF Flag: %x Value: %s\r\n\r\n", obj.Name, obj.Data)
+	}
+}
+
+// decodeAttrString decodes a null terminated atpString or atpText attribute.
+func decodeAttrString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+/**
+ * attDate = Year Month Day Hour Minute Second DayOfWeek
+ *
+ * All fields are UINT16; there is no time zone, so the date is returned in UTC.
+ */
+func decodeAttrDate(data []byte) time.Time {
+	if len(data) < 12 {
+		return time.Time{}
+	}
+	f := make([]int, 6)
+	for i := range f {
+		f[i] = byteToInt(data[i*2 : i*2+2])
+	}
+	return time.Date(f[0], time.Month(f[1]), f[2], f[3], f[4], f[5], 0, time.UTC)
+}
+
+/**
+ * attFrom = TRP sender-display-name sender-address
+ * TRP = trpidOneOff cbgrtrp cch cbRgb
+ *
+ * cch is the size of the display name and cbRgb the size of the address, both
+ * including the terminating null; the address is stored as "TYPE:address".
+ */
+func decodeTRP(data []byte) Address {
+	if len(data) < 8 {
+		return Address{}
+	}
+	cch := byteToInt(data[4:6])
+	cbRgb := byteToInt(data[6:8])
+	data = data[8:]
+	if cch > len(data) {
+		cch = len(data)
+	}
+
+	var addr Address
+	addr.DisplayName = decodeAttrString(data[:cch])
+
+	data = bytes.TrimLeft(data[cch:], "\x00")
+	if cbRgb < len(data) {
+		data = data[:cbRgb]
+	}
+	email := decodeAttrString(data)
+	if i := strings.IndexByte(email, ':'); i >= 0 {
+		addr.AddressType = email[:i]
+		email = email[i+1:]
+	}
+	addr.EmailAddress = email
+	return addr
+}
@@ -0,0 +1,281 @@
+package tnef
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// EncodeMIME writes d to w as an RFC 5322 message with a MIME body, for mail
+// clients that don't understand TNEF.
+//
+// The plain text and HTML bodies are combined in a multipart/alternative. The
+// attachments the HTML body refers to by Content-ID (see
+// AttachmentIsMimeRelated) are added to a multipart/related around it, and the
+// other attachments to a multipart/mixed. Embedded messages are attached as
+// message/rfc822. Attachments without data, like OLE objects, are left out.
+//
+// The Date header is ClientSubmitTime, or DateSent if it's not set.
+func EncodeMIME(w io.Writer, d *Data) error {
+	body, err := d.mimeBody()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range d.mimeHeader() {
+		bw.WriteString(f[0] + ": " + f[1] + "\r\n")
+	}
+	bw.WriteString("MIME-Version: 1.0\r\n")
+	body.writeTo(bw)
+	return bw.Flush()
+}
+
+// mimeHeader returns the message headers for d, in the order they should be
+// written.
+func (d *Data) mimeHeader() [][2]string {
+	var h [][2]string
+	if from := d.sender(); from != nil {
+		h = append(h, [2]string{"From", from.String()})
+	}
+	for _, t := range []RecipientType{RecipientTo, RecipientCc} {
+		var list []string
+		for _, r := range d.Recipients {
+			if r.Type != t {
+				continue
+			}
+			if addr := mailAddress(r.Address, r.Properties.getString(MAPISmtpAddress)); addr != nil {
+				list = append(list, addr.String())
+			}
+		}
+		if len(list) > 0 {
+			h = append(h, [2]string{t.String(), strings.Join(list, ", ")})
+		}
+	}
+	if s := d.subject(); s != "" {
+		h = append(h, [2]string{"Subject", mime.QEncoding.Encode("utf-8", s)})
+	}
+	if !d.ClientSubmitTime.IsZero() {
+		h = append(h, [2]string{"Date", d.ClientSubmitTime.UTC().Format(time.RFC1123Z)})
+	} else if !d.DateSent.IsZero() {
+		// attDateSent is the local time of the sender, in an unknown
+		// time zone; RFC 5322 section 3.3 uses -0000 for that.
+		h = append(h, [2]string{"Date", d.DateSent.Format("Mon, 02 Jan 2006 15:04:05 -0000")})
+	}
+	if id, _ := d.GetString(MAPIInternetMessageID); id != "" {
+		h = append(h, [2]string{"Message-ID", id})
+	}
+	return h
+}
+
+// sender returns the address of the sender, from attFrom or the sender
+// properties.
+func (d *Data) sender() *mail.Address {
+	smtp, _ := d.GetString(MAPISenderSmtpAddress)
+	if addr := mailAddress(d.From, smtp); addr != nil {
+		return addr
+	}
+
+	name, _ := d.GetString(MAPISenderName)
+	email, _ := d.GetString(MAPISenderEmailAddress)
+	return mailAddress(Address{DisplayName: name, EmailAddress: email}, smtp)
+}
+
+// mailAddress converts a to a net/mail address. Addresses that aren't SMTP
+// addresses, like Exchange DNs, use smtp instead; nil is returned if there's
+// no usable address.
+func mailAddress(a Address, smtp string) *mail.Address {
+	email := a.EmailAddress
+	if !strings.EqualFold(a.AddressType, "SMTP") && !(a.AddressType == "" && strings.Contains(email, "@")) {
+		email = smtp
+	}
+	if email == "" {
+		return nil
+	}
+	return &mail.Address{Name: a.DisplayName, Address: email}
+}
+
+// subject returns the subject from attSubject, or from the MAPI properties.
+func (d *Data) subject() string {
+	if d.Subject != "" {
+		return d.Subject
+	}
+	s, _ := d.GetString(MAPISubject)
+	return s
+}
+
+// textBody returns the plain text body, without the terminating null
+// character.
+func (d *Data) textBody() []byte {
+	return bytes.TrimRight(d.Body, "\x00")
+}
+
+// mimeBody creates the MIME body of the message, including the attachments.
+func (d *Data) mimeBody() (mimeEntity, error) {
+	text := d.textBody()
+	html := bytes.TrimRight(d.BodyHTML, "\x00")
+
+	var alternative []mimeEntity
+	if len(text) > 0 || len(html) == 0 {
+		alternative = append(alternative, textEntity("text/plain", text))
+	}
+	if len(html) > 0 {
+		alternative = append(alternative, textEntity("text/html", html))
+	}
+
+	related := []mimeEntity{multipartEntity("alternative", alternative)}
+	var mixed []mimeEntity
+	for _, a := range d.Attachments {
+		isRelated := len(html) > 0 && d.AttachmentIsMimeRelated(a)
+		e, ok, err := attachmentEntity(a, isRelated)
+		if err != nil {
+			return mimeEntity{}, err
+		}
+		if !ok {
+			continue
+		}
+		if isRelated {
+			related = append(related, e)
+		} else {
+			mixed = append(mixed, e)
+		}
+	}
+
+	mixed = append([]mimeEntity{multipartEntity("related", related)}, mixed...)
+	return multipartEntity("mixed", mixed), nil
+}
+
+// mimeEntity is a MIME entity with its body already encoded.
+type mimeEntity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func (e mimeEntity) writeTo(w *bufio.Writer) {
+	keys := make([]string, 0, len(e.header))
+	for k := range e.header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range e.header[k] {
+			w.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	w.WriteString("\r\n")
+	w.Write(e.body)
+}
+
+// textEntity creates a quoted-printable text entity. The charset of text
+// isn't known if it's not UTF-8, but Windows-1252 is the most likely.
+func textEntity(mediaType string, text []byte) mimeEntity {
+	charset := "utf-8"
+	if !utf8.Valid(text) {
+		charset = "windows-1252"
+	}
+
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write(text)
+	qp.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": charset}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimeEntity{header: h, body: buf.Bytes()}
+}
+
+// multipartEntity combines parts in a multipart entity, unless there is only
+// one part.
+func multipartEntity(subtype string, parts []mimeEntity) mimeEntity {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		// Writes to a bytes.Buffer don't fail.
+		pw, _ := mw.CreatePart(p.header)
+		pw.Write(p.body)
+	}
+	mw.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": mw.Boundary()}))
+	return mimeEntity{header: h, body: buf.Bytes()}
+}
+
+// attachmentEntity creates the MIME entity for an attachment; ok is false if
+// the attachment has no data. Related attachments are inline, with the
+// Content-ID from the properties.
+func attachmentEntity(a *Attachment, related bool) (e mimeEntity, ok bool, err error) {
+	h := textproto.MIMEHeader{}
+	disposition := "attachment"
+	if related {
+		disposition = "inline"
+		h.Set("Content-ID", "<"+a.Properties.getString(MAPITagAttachContentId)+">")
+	}
+	dispParams := map[string]string{}
+	if a.Title != "" {
+		dispParams["filename"] = a.Title
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, dispParams))
+
+	if a.EmbeddedMessage != nil {
+		var buf bytes.Buffer
+		if err := EncodeMIME(&buf, a.EmbeddedMessage); err != nil {
+			return e, false, err
+		}
+		h.Set("Content-Type", "message/rfc822")
+		return mimeEntity{header: h, body: buf.Bytes()}, true, nil
+	}
+	if a.Data == nil {
+		return e, false, nil
+	}
+
+	contentType := a.Properties.getString(MAPIAttachMimeTag)
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(a.Title))
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+	if a.Title != "" {
+		params["name"] = a.Title
+	}
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	h.Set("Content-Transfer-Encoding", "base64")
+	return mimeEntity{header: h, body: encodeBase64Lines(a.Data)}, true, nil
+}
+
+// encodeBase64Lines encodes data as base64 in lines of 76 characters.
+func encodeBase64Lines(data []byte) []byte {
+	const lineLength = 76
+	enc := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(enc, data)
+
+	var buf bytes.Buffer
+	for len(enc) > 0 {
+		n := lineLength
+		if n > len(enc) {
+			n = len(enc)
+		}
+		buf.Write(enc[:n])
+		buf.WriteString("\r\n")
+		enc = enc[n:]
+	}
+	return buf.Bytes()
+}
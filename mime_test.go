@@ -0,0 +1,192 @@
+package tnef
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeMIME(t *testing.T) {
+	d := &Data{
+		From:     Address{DisplayName: "Sender", AddressType: "SMTP", EmailAddress: "sender@example.com"},
+		Subject:  "Héllo",
+		DateSent: time.Date(2018, 11, 2, 13, 14, 15, 0, time.UTC),
+		Body:     []byte("The body.\r\n"),
+		BodyHTML: []byte(`<p>The body.<img src="cid:image@example.com"></p>`),
+		Recipients: []Recipient{
+			{Address: Address{DisplayName: "To", AddressType: "SMTP", EmailAddress: "to@example.com"}, Type: RecipientTo},
+			{
+				Address: Address{DisplayName: "Exchange", AddressType: "EX", EmailAddress: "/O=EXAMPLE/CN=CC"},
+				Type:    RecipientCc,
+				Properties: MsgPropertyList{Values: []*MsgPropertyValue{
+					{TagType: szmapiString, TagId: MAPISmtpAddress, Data: "cc@example.com"},
+				}},
+			},
+			{Address: Address{AddressType: "SMTP", EmailAddress: "bcc@example.com"}, Type: RecipientBcc},
+		},
+		Attachments: []*Attachment{
+			{
+				Title: "image.png",
+				Data:  []byte("PNG"),
+				Properties: MsgPropertyList{Values: []*MsgPropertyValue{
+					{TagType: szmapiString, TagId: MAPITagAttachContentId, Data: "image@example.com"},
+				}},
+			},
+			{Title: "report.pdf", Data: []byte("PDF")},
+			{Title: "OLE object"},
+			{Title: "Forwarded", EmbeddedMessage: &Data{Subject: "Forwarded", Body: []byte("inner")}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMIME(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHeader := map[string]string{
+		"From":         `"Sender" <sender@example.com>`,
+		"To":           `"To" <to@example.com>`,
+		"Cc":           `"Exchange" <cc@example.com>`,
+		"Subject":      "=?utf-8?q?H=C3=A9llo?=",
+		"Date":         "Fri, 02 Nov 2018 13:14:15 -0000",
+		"Mime-Version": "1.0",
+		"Bcc":          "",
+	}
+	for k, want := range wantHeader {
+		if got := msg.Header.Get(k); got != want {
+			t.Errorf("wrong %s header\ngot:  %q\nwant: %q", k, got, want)
+		}
+	}
+
+	parts := map[string]string{}
+	got := mimeStructure(t, msg.Header, msg.Body, parts)
+	want := "multipart/mixed[multipart/related[multipart/alternative[text/plain text/html] image/png] application/pdf message/rfc822]"
+	if got != want {
+		t.Errorf("wrong structure\ngot:  %s\nwant: %s", got, want)
+	}
+
+	wantParts := map[string]string{
+		"text/plain":      "The body.\r\n",
+		"text/html":       string(d.BodyHTML),
+		"image/png":       "PNG",
+		"application/pdf": "PDF",
+	}
+	for k, want := range wantParts {
+		if parts[k] != want {
+			t.Errorf("wrong %s part\ngot:  %q\nwant: %q", k, parts[k], want)
+		}
+	}
+	if !strings.Contains(parts["message/rfc822"], "Subject: Forwarded\r\n") {
+		t.Errorf("wrong embedded message: %q", parts["message/rfc822"])
+	}
+}
+
+func TestEncodeMIMEFile(t *testing.T) {
+	d, err := Decode(read(t, "./testdata", "unicode-mapi-attr-name.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMIME(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := mimeStructure(t, msg.Header, msg.Body, map[string]string{})
+	want := "multipart/mixed[multipart/related[text/html image/png image/png image/png] application/octet-stream]"
+	if got != want {
+		t.Errorf("wrong structure\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestEncodeMIMEDate(t *testing.T) {
+	triples, err := Decode(read(t, "./testdata", "triples.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   *Data
+		want string
+	}{
+		// attDateSent is 17:26:17, the local time of the sender.
+		{"ClientSubmitTime", triples, "Fri, 23 May 2003 13:26:17 +0000"},
+		{"DateSent", &Data{DateSent: time.Date(2018, 11, 2, 13, 14, 15, 0, time.UTC)}, "Fri, 02 Nov 2018 13:14:15 -0000"},
+		{"no date", &Data{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeMIME(&buf, tt.in); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := mail.ReadMessage(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := msg.Header.Get("Date"); got != tt.want {
+				t.Errorf("wrong Date header\ngot:  %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type header interface {
+	Get(string) string
+}
+
+// mimeStructure returns the content types of an entity and its parts, and
+// stores the decoded body of the leaf parts in bodies.
+func mimeStructure(t *testing.T, h header, body io.Reader, bodies map[string]string) string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		switch h.Get("Content-Transfer-Encoding") {
+		case "quoted-printable":
+			body = quotedprintable.NewReader(body)
+		case "base64":
+			body = base64.NewDecoder(base64.StdEncoding, body)
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[mediaType] = string(b)
+		return mediaType
+	}
+
+	var parts []string
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimeStructure(t, p.Header, p, bodies))
+	}
+	return mediaType + "[" + strings.Join(parts, " ") + "]"
+}
@@ -0,0 +1,279 @@
+package tnef
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Property sets of the well-known named properties.
+var (
+	PSETIDAppointment = mustParseGUID("{00062002-0000-0000-C000-000000000046}")
+	PSETIDTask        = mustParseGUID("{00062003-0000-0000-C000-000000000046}")
+	PSETIDAddress     = mustParseGUID("{00062004-0000-0000-C000-000000000046}")
+	PSETIDCommon      = mustParseGUID("{00062008-0000-0000-C000-000000000046}")
+	PSETIDMeeting     = mustParseGUID("{6ED8DA90-450B-101B-98DA-00AA003F1305}")
+	PSPublicStrings   = mustParseGUID("{00020329-0000-0000-C000-000000000046}")
+	PSInternetHeaders = mustParseGUID("{00020386-0000-0000-C000-000000000046}")
+)
+
+// NamedProperty identifies a named property, i.e. a property with an id of
+// 0x8000 or more in the stream. The id in the stream is assigned by the writer;
+// the property is identified by its property set and either a numeric id (the
+// LID) or a string name.
+type NamedProperty struct {
+	Set  GUID
+	ID   uint32 // the LID; only used if Name is ""
+	Name string
+}
+
+// namedProperties maps the names of the well-known named properties, as in
+// [MS-OXPROPS], to their identity. Properties with a string name are listed by
+// that name.
+var namedProperties = map[string]NamedProperty{
+	// PSETID_Appointment
+	"PidLidAppointmentSequence":                       {Set: PSETIDAppointment, ID: 0x8201},
+	"PidLidBusyStatus":                                {Set: PSETIDAppointment, ID: 0x8205},
+	"PidLidLocation":                                  {Set: PSETIDAppointment, ID: 0x8208},
+	"PidLidAppointmentStartWhole":                     {Set: PSETIDAppointment, ID: 0x820D},
+	"PidLidAppointmentEndWhole":                       {Set: PSETIDAppointment, ID: 0x820E},
+	"PidLidAppointmentDuration":                       {Set: PSETIDAppointment, ID: 0x8213},
+	"PidLidAppointmentSubType":                        {Set: PSETIDAppointment, ID: 0x8215},
+	"PidLidAppointmentRecur":                          {Set: PSETIDAppointment, ID: 0x8216},
+	"PidLidAppointmentStateFlags":                     {Set: PSETIDAppointment, ID: 0x8217},
+	"PidLidResponseStatus":                            {Set: PSETIDAppointment, ID: 0x8218},
+	"PidLidRecurring":                                 {Set: PSETIDAppointment, ID: 0x8223},
+	"PidLidIntendedBusyStatus":                        {Set: PSETIDAppointment, ID: 0x8224},
+	"PidLidRecurrenceType":                            {Set: PSETIDAppointment, ID: 0x8231},
+	"PidLidRecurrencePattern":                         {Set: PSETIDAppointment, ID: 0x8232},
+	"PidLidTimeZoneStruct":                            {Set: PSETIDAppointment, ID: 0x8233},
+	"PidLidTimeZoneDescription":                       {Set: PSETIDAppointment, ID: 0x8234},
+	"PidLidClipStart":                                 {Set: PSETIDAppointment, ID: 0x8235},
+	"PidLidClipEnd":                                   {Set: PSETIDAppointment, ID: 0x8236},
+	"PidLidAllAttendeesString":                        {Set: PSETIDAppointment, ID: 0x8238},
+	"PidLidToAttendeesString":                         {Set: PSETIDAppointment, ID: 0x823B},
+	"PidLidCcAttendeesString":                         {Set: PSETIDAppointment, ID: 0x823C},
+	"PidLidAppointmentTimeZoneDefinitionStartDisplay": {Set: PSETIDAppointment, ID: 0x825E},
+	"PidLidAppointmentTimeZoneDefinitionEndDisplay":   {Set: PSETIDAppointment, ID: 0x825F},
+	"PidLidAppointmentTimeZoneDefinitionRecur":        {Set: PSETIDAppointment, ID: 0x8260},
+
+	// PSETID_Meeting
+	"PidLidAttendeeCriticalChange": {Set: PSETIDMeeting, ID: 0x0001},
+	"PidLidWhere":                  {Set: PSETIDMeeting, ID: 0x0002},
+	"PidLidGlobalObjectId":         {Set: PSETIDMeeting, ID: 0x0003},
+	"PidLidIsSilent":               {Set: PSETIDMeeting, ID: 0x0004},
+	"PidLidIsRecurring":            {Set: PSETIDMeeting, ID: 0x0005},
+	"PidLidIsException":            {Set: PSETIDMeeting, ID: 0x000A},
+	"PidLidTimeZone":               {Set: PSETIDMeeting, ID: 0x000C},
+	"PidLidOwnerCriticalChange":    {Set: PSETIDMeeting, ID: 0x001A},
+	"PidLidCalendarType":           {Set: PSETIDMeeting, ID: 0x001C},
+	"PidLidCleanGlobalObjectId":    {Set: PSETIDMeeting, ID: 0x0023},
+	"PidLidMeetingType":            {Set: PSETIDMeeting, ID: 0x0026},
+
+	// PSETID_Task
+	"PidLidTaskStatus":        {Set: PSETIDTask, ID: 0x8101},
+	"PidLidPercentComplete":   {Set: PSETIDTask, ID: 0x8102},
+	"PidLidTaskStartDate":     {Set: PSETIDTask, ID: 0x8104},
+	"PidLidTaskDueDate":       {Set: PSETIDTask, ID: 0x8105},
+	"PidLidTaskDateCompleted": {Set: PSETIDTask, ID: 0x810F},
+	"PidLidTaskRecurrence":    {Set: PSETIDTask, ID: 0x8116},
+	"PidLidTaskComplete":      {Set: PSETIDTask, ID: 0x811C},
+	"PidLidTaskOwner":         {Set: PSETIDTask, ID: 0x811F},
+
+	// PSETID_Address
+	"PidLidFileUnder":                {Set: PSETIDAddress, ID: 0x8005},
+	"PidLidHasPicture":               {Set: PSETIDAddress, ID: 0x8015},
+	"PidLidHomeAddress":              {Set: PSETIDAddress, ID: 0x801A},
+	"PidLidWorkAddress":              {Set: PSETIDAddress, ID: 0x801B},
+	"PidLidOtherAddress":             {Set: PSETIDAddress, ID: 0x801C},
+	"PidLidPostalAddressId":          {Set: PSETIDAddress, ID: 0x8022},
+	"PidLidHtml":                     {Set: PSETIDAddress, ID: 0x802B},
+	"PidLidWorkAddressStreet":        {Set: PSETIDAddress, ID: 0x8045},
+	"PidLidWorkAddressCity":          {Set: PSETIDAddress, ID: 0x8046},
+	"PidLidWorkAddressState":         {Set: PSETIDAddress, ID: 0x8047},
+	"PidLidWorkAddressPostalCode":    {Set: PSETIDAddress, ID: 0x8048},
+	"PidLidWorkAddressCountry":       {Set: PSETIDAddress, ID: 0x8049},
+	"PidLidWorkAddressPostOfficeBox": {Set: PSETIDAddress, ID: 0x804A},
+	"PidLidInstantMessagingAddress":  {Set: PSETIDAddress, ID: 0x8062},
+	"PidLidEmail1DisplayName":        {Set: PSETIDAddress, ID: 0x8080},
+	"PidLidEmail1AddressType":        {Set: PSETIDAddress, ID: 0x8082},
+	"PidLidEmail1EmailAddress":       {Set: PSETIDAddress, ID: 0x8083},
+	"PidLidEmail2DisplayName":        {Set: PSETIDAddress, ID: 0x8090},
+	"PidLidEmail2AddressType":        {Set: PSETIDAddress, ID: 0x8092},
+	"PidLidEmail2EmailAddress":       {Set: PSETIDAddress, ID: 0x8093},
+	"PidLidEmail3DisplayName":        {Set: PSETIDAddress, ID: 0x80A0},
+	"PidLidEmail3AddressType":        {Set: PSETIDAddress, ID: 0x80A2},
+	"PidLidEmail3EmailAddress":       {Set: PSETIDAddress, ID: 0x80A3},
+
+	// PSETID_Common
+	"PidLidReminderDelta":       {Set: PSETIDCommon, ID: 0x8501},
+	"PidLidReminderTime":        {Set: PSETIDCommon, ID: 0x8502},
+	"PidLidReminderSet":         {Set: PSETIDCommon, ID: 0x8503},
+	"PidLidPrivate":             {Set: PSETIDCommon, ID: 0x8506},
+	"PidLidSideEffects":         {Set: PSETIDCommon, ID: 0x8510},
+	"PidLidCommonStart":         {Set: PSETIDCommon, ID: 0x8516},
+	"PidLidCommonEnd":           {Set: PSETIDCommon, ID: 0x8517},
+	"PidLidTaskMode":            {Set: PSETIDCommon, ID: 0x8518},
+	"PidLidCompanies":           {Set: PSETIDCommon, ID: 0x8539},
+	"PidLidContacts":            {Set: PSETIDCommon, ID: 0x853A},
+	"PidLidCurrentVersion":      {Set: PSETIDCommon, ID: 0x8552},
+	"PidLidCurrentVersionName":  {Set: PSETIDCommon, ID: 0x8554},
+	"PidLidReminderSignalTime":  {Set: PSETIDCommon, ID: 0x8560},
+	"PidLidInternetAccountName": {Set: PSETIDCommon, ID: 0x8580},
+
+	// PS_PUBLIC_STRINGS and PS_INTERNET_HEADERS
+	"Keywords":      {Set: PSPublicStrings, Name: "Keywords"},
+	"Content-Class": {Set: PSInternetHeaders, Name: "content-class"},
+}
+
+// namedRegistry is the registry of named properties, which starts with
+// namedProperties.
+var namedRegistry struct {
+	sync.RWMutex
+	byName map[string]NamedProperty
+	byProp map[NamedProperty]string
+}
+
+func init() {
+	namedRegistry.byName = make(map[string]NamedProperty, len(namedProperties))
+	namedRegistry.byProp = make(map[NamedProperty]string, len(namedProperties))
+	for name, p := range namedProperties {
+		namedRegistry.byName[name] = p
+		namedRegistry.byProp[p.key()] = name
+	}
+}
+
+// RegisterNamedProperty adds a named property to the registry, so it can be
+// found by name with GetNamed and LookupNamedProperty. It replaces a
+// registered property with the same name.
+func RegisterNamedProperty(name string, p NamedProperty) {
+	namedRegistry.Lock()
+	defer namedRegistry.Unlock()
+	if old, ok := namedRegistry.byName[name]; ok {
+		delete(namedRegistry.byProp, old.key())
+	}
+	namedRegistry.byName[name] = p
+	namedRegistry.byProp[p.key()] = name
+}
+
+// LookupNamedProperty returns the registered named property with the given
+// name, e.g. "PidLidAppointmentStartWhole" or "Keywords".
+func LookupNamedProperty(name string) (NamedProperty, bool) {
+	namedRegistry.RLock()
+	defer namedRegistry.RUnlock()
+	p, ok := namedRegistry.byName[name]
+	return p, ok
+}
+
+// key returns p as it's used for comparisons; the names of internet headers
+// are case insensitive.
+func (p NamedProperty) key() NamedProperty {
+	if p.Name != "" {
+		p.ID = 0
+		if p.Set == PSInternetHeaders {
+			p.Name = strings.ToLower(p.Name)
+		}
+	}
+	return p
+}
+
+// Named returns the identity of a named property; ok is false if it isn't a
+// named property.
+func (p *Property) Named() (np NamedProperty, ok bool) {
+	if p.TagId < 0x8000 {
+		return np, false
+	}
+	np.Set = p.PropNameSpace
+	if p.PropIDType == 0 {
+		if len(p.PropMap) >= 4 {
+			np.ID = binary.LittleEndian.Uint32(p.PropMap)
+		}
+	} else {
+		np.Name = strings.TrimRight(string(p.PropMap), "\x00")
+	}
+	return np, true
+}
+
+// Name returns the registered name of a named property, or "" if it's not
+// registered.
+func (p *Property) Name() string {
+	np, ok := p.Named()
+	if !ok {
+		return ""
+	}
+	namedRegistry.RLock()
+	defer namedRegistry.RUnlock()
+	return namedRegistry.byProp[np.key()]
+}
+
+// Lookup returns the first value of the named property p, or nil if there is
+// none.
+func (l MsgPropertyList) Lookup(p NamedProperty) *Property {
+	p = p.key()
+	for _, v := range l.Values {
+		if np, ok := v.Named(); ok && np.key() == p {
+			return v
+		}
+	}
+	return nil
+}
+
+// GetNamed returns the first value of the registered named property with the
+// given name, or nil if there is none.
+func (l MsgPropertyList) GetNamed(name string) *Property {
+	p, ok := LookupNamedProperty(name)
+	if !ok {
+		return nil
+	}
+	return l.Lookup(p)
+}
+
+// GetNamed returns a registered named property of the message; see
+// MsgPropertyList.GetNamed.
+func (c *Data) GetNamed(name string) *Property { return c.Properties.GetNamed(name) }
+
+// GetNamed returns a registered named property of the attachment.
+func (a *Attachment) GetNamed(name string) *Property { return a.Properties.GetNamed(name) }
+
+// namedString, namedInt32, namedBool, namedTime and namedBinary return the
+// value of a registered named property of the message.
+func (d *Data) namedString(name string) (string, bool) {
+	if v := d.GetNamed(name); v != nil {
+		s, ok := v.Data.(string)
+		return s, ok
+	}
+	return "", false
+}
+
+func (d *Data) namedInt32(name string) (int32, bool) {
+	if v := d.GetNamed(name); v != nil {
+		n, ok := v.Data.(int32)
+		return n, ok
+	}
+	return 0, false
+}
+
+func (d *Data) namedBool(name string) (bool, bool) {
+	if v := d.GetNamed(name); v != nil {
+		b, ok := v.Data.(bool)
+		return b, ok
+	}
+	return false, false
+}
+
+func (d *Data) namedTime(name string) (time.Time, bool) {
+	if v := d.GetNamed(name); v != nil {
+		t, ok := v.Data.(time.Time)
+		return t, ok
+	}
+	return time.Time{}, false
+}
+
+func (d *Data) namedBinary(name string) ([]byte, bool) {
+	if v := d.GetNamed(name); v != nil {
+		b, ok := v.Data.([]byte)
+		return b, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,81 @@
+package tnef
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNamedProperties(t *testing.T) {
+	tests := []struct {
+		file string
+		name string
+		want interface{}
+	}{
+		{"triples", "PidLidAppointmentStartWhole", time.Date(2003, 5, 23, 14, 0, 0, 0, time.UTC)},
+		{"triples", "PidLidLocation", "Sample Location"},
+		{"triples", "PidLidReminderSet", true},
+		{"multi-name-property", "Keywords", []string{"Feiertag"}},
+		{"multi-value-attribute", "Content-Class", "voice"},
+		{"triples", "Keywords", nil},
+		{"triples", "NotRegistered", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.name, func(t *testing.T) {
+			out, err := Decode(read(t, "./testdata", tt.file+".tnef"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := out.GetNamed(tt.name)
+			if tt.want == nil {
+				if v != nil {
+					t.Fatalf("found %#v", v)
+				}
+				return
+			}
+			if v == nil {
+				t.Fatal("not found")
+			}
+			if !reflect.DeepEqual(v.Data, tt.want) {
+				t.Errorf("got %#v; want %#v", v.Data, tt.want)
+			}
+			if v.Name() != tt.name {
+				t.Errorf("wrong Name(): %q", v.Name())
+			}
+		})
+	}
+}
+
+func TestRegisterNamedProperty(t *testing.T) {
+	out, err := Decode(read(t, "./testdata", "multi-value-attribute.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := out.GetNamed("IsSigned"); v != nil {
+		t.Fatalf("found an unregistered property: %#v", v)
+	}
+
+	set, _ := ParseGUID("{41F28F13-83F4-4114-A584-EEDB5A6B0BFF}")
+	p := NamedProperty{Set: set, Name: "IsSigned"}
+	RegisterNamedProperty("IsSigned", p)
+	if got, ok := LookupNamedProperty("IsSigned"); !ok || got != p {
+		t.Errorf("LookupNamedProperty: %#v, %v", got, ok)
+	}
+	v := out.GetNamed("IsSigned")
+	if v == nil || v.Data != false || v.Name() != "IsSigned" {
+		t.Errorf("wrong value: %#v", v)
+	}
+	if out.Properties.Lookup(p) != v {
+		t.Error("Lookup doesn't return the same value")
+	}
+
+	// Registering the name again replaces it.
+	RegisterNamedProperty("IsSigned", NamedProperty{Set: set, Name: "IsReadReceipt"})
+	if v.Name() != "" {
+		t.Errorf("old property still has the name %q", v.Name())
+	}
+	if v := out.GetNamed("IsSigned"); v == nil || v.Name() != "IsSigned" {
+		t.Errorf("wrong value after registering again: %#v", v)
+	}
+}
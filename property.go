@@ -0,0 +1,123 @@
+package tnef
+
+import (
+	"bytes"
+	"time"
+)
+
+// GetString returns the value of a string property. Both PT_STRING8 and
+// PT_UNICODE properties are returned as a string, and so is a PT_BINARY
+// property, as some writers use it for strings. ok is false if there is no
+// such property.
+func (l MsgPropertyList) GetString(tag int) (s string, ok bool) {
+	v := l.get(tag)
+	if v == nil {
+		return "", false
+	}
+	switch d := v.Data.(type) {
+	case string:
+		return d, true
+	case []byte:
+		if v.TagType == szmapiBinary {
+			return string(bytes.TrimRight(d, "\x00")), true
+		}
+	}
+	return "", false
+}
+
+// GetStrings returns the values of a multi-valued string property. A single
+// valued string property is returned as a list of one string.
+func (l MsgPropertyList) GetStrings(tag int) ([]string, bool) {
+	v := l.get(tag)
+	if v == nil {
+		return nil, false
+	}
+	switch d := v.Data.(type) {
+	case []string:
+		return d, true
+	case string:
+		return []string{d}, true
+	}
+	return nil, false
+}
+
+// GetInt32 returns the value of a PT_LONG or PT_SHORT property.
+func (l MsgPropertyList) GetInt32(tag int) (int32, bool) {
+	v := l.get(tag)
+	if v == nil {
+		return 0, false
+	}
+	switch d := v.Data.(type) {
+	case int32:
+		return d, true
+	case int16:
+		return int32(d), true
+	}
+	return 0, false
+}
+
+// GetBool returns the value of a PT_BOOLEAN property.
+func (l MsgPropertyList) GetBool(tag int) (b, ok bool) {
+	if v := l.get(tag); v != nil {
+		b, ok = v.Data.(bool)
+	}
+	return b, ok
+}
+
+// GetTime returns the value of a PT_SYSTIME property.
+func (l MsgPropertyList) GetTime(tag int) (time.Time, bool) {
+	if v := l.get(tag); v != nil {
+		t, ok := v.Data.(time.Time)
+		return t, ok
+	}
+	return time.Time{}, false
+}
+
+// GetBinary returns the value of a PT_BINARY or PT_OBJECT property.
+func (l MsgPropertyList) GetBinary(tag int) ([]byte, bool) {
+	if v := l.get(tag); v != nil {
+		b, ok := v.Data.([]byte)
+		return b, ok
+	}
+	return nil, false
+}
+
+// GetString returns the value of a string property of the message; see
+// MsgPropertyList.GetString.
+func (c *Data) GetString(tag int) (string, bool) { return c.Properties.GetString(tag) }
+
+// GetStrings returns the values of a multi-valued string property of the
+// message.
+func (c *Data) GetStrings(tag int) ([]string, bool) { return c.Properties.GetStrings(tag) }
+
+// GetInt32 returns the value of an integer property of the message.
+func (c *Data) GetInt32(tag int) (int32, bool) { return c.Properties.GetInt32(tag) }
+
+// GetBool returns the value of a boolean property of the message.
+func (c *Data) GetBool(tag int) (bool, bool) { return c.Properties.GetBool(tag) }
+
+// GetTime returns the value of a time property of the message.
+func (c *Data) GetTime(tag int) (time.Time, bool) { return c.Properties.GetTime(tag) }
+
+// GetBinary returns the value of a binary property of the message.
+func (c *Data) GetBinary(tag int) ([]byte, bool) { return c.Properties.GetBinary(tag) }
+
+// GetString returns the value of a string property of the attachment; see
+// MsgPropertyList.GetString.
+func (a *Attachment) GetString(tag int) (string, bool) { return a.Properties.GetString(tag) }
+
+// GetStrings returns the values of a multi-valued string property of the
+// attachment.
+func (a *Attachment) GetStrings(tag int) ([]string, bool) { return a.Properties.GetStrings(tag) }
+
+// GetInt32 returns the value of an integer property of the attachment.
+func (a *Attachment) GetInt32(tag int) (int32, bool) { return a.Properties.GetInt32(tag) }
+
+// GetBool returns the value of a boolean property of the attachment.
+func (a *Attachment) GetBool(tag int) (bool, bool) { return a.Properties.GetBool(tag) }
+
+// GetTime returns the value of a time property of the attachment.
+func (a *Attachment) GetTime(tag int) (time.Time, bool) { return a.Properties.GetTime(tag) }
+
+// GetBinary returns the value of a binary property of the attachment.
+func (a *Attachment) GetBinary(tag int) ([]byte, bool) { return a.Properties.GetBinary(tag) }
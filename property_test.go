@@ -0,0 +1,65 @@
+package tnef
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPropertyGetters(t *testing.T) {
+	props := MsgPropertyList{Values: []*Property{
+		{TagType: szmapiString, TagId: MAPISubject, Data: "string8"},
+		{TagType: szmapiUnicodeString, TagId: MAPIBody, Data: "unicode"},
+		{TagType: szmapiBinary, TagId: MAPITagAttachContentId, Data: []byte("cid@example.com\x00")},
+		{TagType: szmapiString | mvFlag, TagId: MAPIDisplayName, Data: []string{"a", "b"}},
+		{TagType: szmapiInt, TagId: MAPIImportance, Data: int32(2)},
+		{TagType: szmapiShort, TagId: MAPIPriority, Data: int16(-1)},
+		{TagType: szmapiBoolean, TagId: MAPIReadReceiptRequested, Data: true},
+		{TagType: szmapiSystime, TagId: MAPIClientSubmitTime, Data: filetimeToTime(131860000000000000)},
+		{TagType: szmapiObject, TagId: MAPIAttachDataObj, Data: []byte{1, 2, 3}},
+	}}
+
+	tests := []struct {
+		name   string
+		get    func() (interface{}, bool)
+		want   interface{}
+		wantOK bool
+	}{
+		{"string8", func() (interface{}, bool) { return props.GetString(MAPISubject) }, "string8", true},
+		{"unicode", func() (interface{}, bool) { return props.GetString(MAPIBody) }, "unicode", true},
+		{"binary string", func() (interface{}, bool) { return props.GetString(MAPITagAttachContentId) }, "cid@example.com", true},
+		{"not a string", func() (interface{}, bool) { return props.GetString(MAPIImportance) }, "", false},
+		{"missing", func() (interface{}, bool) { return props.GetString(MAPISenderName) }, "", false},
+		{"strings", func() (interface{}, bool) { return props.GetStrings(MAPIDisplayName) }, []string{"a", "b"}, true},
+		{"single string", func() (interface{}, bool) { return props.GetStrings(MAPISubject) }, []string{"string8"}, true},
+		{"int32", func() (interface{}, bool) { return props.GetInt32(MAPIImportance) }, int32(2), true},
+		{"int16", func() (interface{}, bool) { return props.GetInt32(MAPIPriority) }, int32(-1), true},
+		{"not an int", func() (interface{}, bool) { return props.GetInt32(MAPISubject) }, int32(0), false},
+		{"bool", func() (interface{}, bool) { return props.GetBool(MAPIReadReceiptRequested) }, true, true},
+		{"time", func() (interface{}, bool) { return props.GetTime(MAPIClientSubmitTime) },
+			time.Date(2018, 11, 6, 17, 46, 40, 0, time.UTC), true},
+		{"not a time", func() (interface{}, bool) { return props.GetTime(MAPIImportance) }, time.Time{}, false},
+		{"object", func() (interface{}, bool) { return props.GetBinary(MAPIAttachDataObj) }, []byte{1, 2, 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.get()
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("got %#v, %v; want %#v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	a := &Attachment{Properties: props}
+	d := &Data{BodyHTML: []byte(`<img src="cid:cid@example.com">`), Properties: props}
+	if s, ok := a.GetString(MAPITagAttachContentId); !ok || s != "cid@example.com" {
+		t.Errorf("Attachment.GetString: %q, %v", s, ok)
+	}
+	if s, ok := d.GetString(MAPISubject); !ok || s != "string8" {
+		t.Errorf("Data.GetString: %q, %v", s, ok)
+	}
+	if !d.AttachmentIsMimeRelated(a) {
+		t.Error("attachment with a binary Content-ID isn't related")
+	}
+}
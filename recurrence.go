@@ -0,0 +1,442 @@
+package tnef
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Recurrence frequencies, the Frequency of a Recurrence.
+const (
+	RecurDaily   = 0x200A
+	RecurWeekly  = 0x200B
+	RecurMonthly = 0x200C
+	RecurYearly  = 0x200D
+)
+
+// Recurrence pattern types, the PatternType of a Recurrence. The Hj types use
+// the Hijri calendar.
+const (
+	PatternDay        = 0x0000
+	PatternWeek       = 0x0001
+	PatternMonth      = 0x0002
+	PatternMonthNth   = 0x0003
+	PatternMonthEnd   = 0x0004
+	PatternHjMonth    = 0x000A
+	PatternHjMonthNth = 0x000B
+	PatternHjMonthEnd = 0x000C
+)
+
+// Ends of a recurrence, the EndType of a Recurrence.
+const (
+	RecurEndAfterDate = 0x2021
+	RecurEndAfterN    = 0x2022
+	RecurNoEnd        = 0x2023
+)
+
+// Fields of a RecurrenceException that override the series, the bits of its
+// OverrideFlags.
+const (
+	AROSubject       = 0x0001
+	AROMeetingType   = 0x0002
+	AROReminderDelta = 0x0004
+	AROReminder      = 0x0008
+	AROLocation      = 0x0010
+	AROBusyStatus    = 0x0020
+	AROAttachment    = 0x0040
+	AROSubType       = 0x0080
+	AROApptColor     = 0x0100
+	AROExceptionBody = 0x0200
+)
+
+// recurHighlightVersion is the first WriterVersion2 with a ChangeHighlight in
+// the ExtendedExceptions.
+const recurHighlightVersion = 0x3009
+
+// Recurrence is a recurrence pattern from [MS-OXOCAL], as stored in
+// PidLidAppointmentRecur.
+//
+// The dates and times are in the time zone of the appointment, which isn't
+// part of the pattern; they're stored as UTC, so the year, month, day, hour and
+// minute are the local time.
+type Recurrence struct {
+	Frequency     uint16 // RecurDaily, RecurWeekly, ...
+	PatternType   uint16 // PatternDay, PatternWeek, ...
+	CalendarType  uint16
+	FirstDateTime uint32
+	Period        uint32 // in minutes for PatternDay, weeks for PatternWeek, or months
+	SlidingFlag   uint32
+
+	DayOfWeek  uint32 // PatternWeek and PatternMonthNth: bit 0 is Sunday, bit 6 Saturday
+	DayOfMonth uint32 // PatternMonth and PatternMonthEnd
+	N          uint32 // PatternMonthNth: the first to fourth, or 5 for the last
+
+	EndType         uint32 // RecurEndAfterDate, RecurEndAfterN or RecurNoEnd
+	OccurrenceCount uint32
+	FirstDOW        uint32 // the first day of the week; 0 is Sunday
+
+	DeletedInstanceDates  []time.Time // the original dates of deleted and modified instances
+	ModifiedInstanceDates []time.Time // the dates of modified instances
+	StartDate             time.Time   // the date of the first instance
+	EndDate               time.Time   // the date of the last instance
+
+	// The AppointmentRecurrencePattern after the pattern; StartTimeOffset
+	// and EndTimeOffset are the times of the instances from midnight.
+	StartTimeOffset time.Duration
+	EndTimeOffset   time.Duration
+	Exceptions      []RecurrenceException
+}
+
+// RecurrenceException is a modified instance of a recurring appointment. The
+// fields after OverrideFlags are only set if their ARO flag is.
+type RecurrenceException struct {
+	Start         time.Time // the new start of the instance
+	End           time.Time
+	OriginalStart time.Time // the start of the instance in the pattern
+	OverrideFlags uint16
+
+	Subject          string // AROSubject
+	MeetingType      uint32 // AROMeetingType
+	ReminderDelta    int32  // AROReminderDelta, in minutes
+	ReminderSet      bool   // AROReminder
+	Location         string // AROLocation
+	BusyStatus       int32  // AROBusyStatus
+	Attachment       bool   // AROAttachment
+	AllDay           bool   // AROSubType
+	AppointmentColor int32  // AROApptColor
+}
+
+// DecodeRecurrence decodes a recurrence pattern, as stored in
+// PidLidAppointmentRecur. Subjects and locations of exceptions that are only
+// stored as 8-bit strings are left as they are; use Data.Recurrence to convert
+// them with the code page of the message.
+func DecodeRecurrence(data []byte) (*Recurrence, error) {
+	return decodeRecurrence(data, 0)
+}
+
+// Recurrence returns the recurrence pattern of a recurring appointment or
+// meeting request, or nil if there isn't one.
+func (d *Data) Recurrence() (*Recurrence, error) {
+	data, ok := d.namedBinary("PidLidAppointmentRecur")
+	if !ok {
+		return nil, nil
+	}
+	return decodeRecurrence(data, d.CodePage())
+}
+
+// minutesToTime converts the number of minutes since January 1, 1601, as used
+// in recurrence patterns, to a time.Time.
+func minutesToTime(m uint32) time.Time {
+	return time.Unix(int64(m)*60-filetimeEpoch, 0).UTC()
+}
+
+// decodeRecurrence decodes a recurrence pattern, with the 8-bit strings in code
+// page cp.
+func decodeRecurrence(data []byte, cp int) (*Recurrence, error) {
+	/**
+	RecurrencePattern = ReaderVersion WriterVersion RecurFrequency PatternType
+	                    CalendarType FirstDateTime Period SlidingFlag
+	                    PatternTypeSpecific EndType OccurrenceCount FirstDOW
+	                    DeletedInstanceCount *DeletedInstanceDate
+	                    ModifiedInstanceCount *ModifiedInstanceDate
+	                    StartDate EndDate
+	ReaderVersion, WriterVersion = 0x3004 (UINT16)
+	RecurFrequency, PatternType, CalendarType = UINT16
+	PatternTypeSpecific = "" / DayOfWeek / DayOfMonth / DayOfWeek N
+	...Count = UINT32 ; all other fields are UINT32, dates in minutes
+
+	AppointmentRecurrencePattern = RecurrencePattern ReaderVersion2 WriterVersion2
+	                               StartTimeOffset EndTimeOffset ExceptionCount
+	                               *ExceptionInfo ReservedBlock1
+	                               *ExtendedException ReservedBlock2
+	ReaderVersion2 = 0x3006 (UINT32)
+	ExceptionCount = UINT16
+	ReservedBlock = Size *BYTE
+	*/
+	c := leCursor{data: data}
+	if v := c.uint16(); !c.err && v != 0x3004 {
+		return nil, fmt.Errorf("DecodeRecurrence: unknown reader version %#04x", v)
+	}
+	c.uint16() // WriterVersion
+
+	r := &Recurrence{
+		Frequency:     c.uint16(),
+		PatternType:   c.uint16(),
+		CalendarType:  c.uint16(),
+		FirstDateTime: c.uint32(),
+		Period:        c.uint32(),
+		SlidingFlag:   c.uint32(),
+	}
+	switch r.PatternType {
+	case PatternDay:
+	case PatternWeek:
+		r.DayOfWeek = c.uint32()
+	case PatternMonth, PatternMonthEnd, PatternHjMonth, PatternHjMonthEnd:
+		r.DayOfMonth = c.uint32()
+	case PatternMonthNth, PatternHjMonthNth:
+		r.DayOfWeek = c.uint32()
+		r.N = c.uint32()
+	default:
+		if !c.err {
+			return nil, fmt.Errorf("DecodeRecurrence: unknown pattern type %#04x", r.PatternType)
+		}
+	}
+	r.EndType = c.uint32()
+	r.OccurrenceCount = c.uint32()
+	r.FirstDOW = c.uint32()
+	for i, n := 0, c.count(4); i < n; i++ {
+		r.DeletedInstanceDates = append(r.DeletedInstanceDates, minutesToTime(c.uint32()))
+	}
+	for i, n := 0, c.count(4); i < n; i++ {
+		r.ModifiedInstanceDates = append(r.ModifiedInstanceDates, minutesToTime(c.uint32()))
+	}
+	r.StartDate = minutesToTime(c.uint32())
+	r.EndDate = minutesToTime(c.uint32())
+	if c.err {
+		return nil, fmt.Errorf("DecodeRecurrence: at offset %d: %w", c.errOffset, ErrTruncated)
+	}
+	if c.remaining() == 0 {
+		// A RecurrencePattern without the appointment part, as used for
+		// tasks.
+		return r, nil
+	}
+
+	if v := c.uint32(); !c.err && v != 0x3006 {
+		return nil, fmt.Errorf("DecodeRecurrence: unknown reader version %#04x", v)
+	}
+	writerVersion2 := c.uint32()
+	r.StartTimeOffset = time.Duration(c.uint32()) * time.Minute
+	r.EndTimeOffset = time.Duration(c.uint32()) * time.Minute
+
+	n := int(c.uint16())
+	if !c.err && n > c.remaining()/14 { // the smallest ExceptionInfo
+		c.err, c.errOffset = true, c.offset-2
+	}
+	for i := 0; i < n && !c.err; i++ {
+		/**
+		ExceptionInfo = StartDateTime EndDateTime OriginalStartDate OverrideFlags
+		                [Subject] [MeetingType] [ReminderDelta] [ReminderSet]
+		                [Location] [BusyStatus] [Attachment] [SubType]
+		                [AppointmentColor]
+		OverrideFlags = UINT16
+		Subject, Location = Length (UINT16) Length2 (UINT16) *BYTE
+		*/
+		e := RecurrenceException{
+			Start:         minutesToTime(c.uint32()),
+			End:           minutesToTime(c.uint32()),
+			OriginalStart: minutesToTime(c.uint32()),
+			OverrideFlags: c.uint16(),
+		}
+		f := e.OverrideFlags
+		if f&AROSubject != 0 {
+			e.Subject = decodeString8(cp, recurString8(&c))
+		}
+		if f&AROMeetingType != 0 {
+			e.MeetingType = c.uint32()
+		}
+		if f&AROReminderDelta != 0 {
+			e.ReminderDelta = int32(c.uint32())
+		}
+		if f&AROReminder != 0 {
+			e.ReminderSet = c.uint32() != 0
+		}
+		if f&AROLocation != 0 {
+			e.Location = decodeString8(cp, recurString8(&c))
+		}
+		if f&AROBusyStatus != 0 {
+			e.BusyStatus = int32(c.uint32())
+		}
+		if f&AROAttachment != 0 {
+			e.Attachment = c.uint32() != 0
+		}
+		if f&AROSubType != 0 {
+			e.AllDay = c.uint32() != 0
+		}
+		if f&AROApptColor != 0 {
+			e.AppointmentColor = int32(c.uint32())
+		}
+		r.Exceptions = append(r.Exceptions, e)
+	}
+	c.next(c.count(1)) // ReservedBlock1
+	if c.err {
+		return nil, fmt.Errorf("DecodeRecurrence: at offset %d: %w", c.errOffset, ErrTruncated)
+	}
+
+	// The ExtendedExceptions have the subjects and locations in Unicode.
+	// Some writers leave them out.
+	for i := range r.Exceptions {
+		if c.remaining() <= 4 {
+			break
+		}
+		/**
+		ExtendedException = [ChangeHighlight] ReservedBlockEE1
+		                    [StartDateTime EndDateTime OriginalStartDate
+		                    [WideCharSubject] [WideCharLocation] ReservedBlockEE2]
+		ChangeHighlight = Size (UINT32) *BYTE
+		WideCharSubject, WideCharLocation = Length (UINT16) *WCHAR
+		*/
+		e := &r.Exceptions[i]
+		if writerVersion2 >= recurHighlightVersion {
+			c.next(c.count(1))
+		}
+		c.next(c.count(1))
+		if e.OverrideFlags&(AROSubject|AROLocation) != 0 {
+			c.next(12)
+			if e.OverrideFlags&AROSubject != 0 {
+				e.Subject = utf16String(&c)
+			}
+			if e.OverrideFlags&AROLocation != 0 {
+				e.Location = utf16String(&c)
+			}
+			c.next(c.count(1))
+		}
+		if c.err {
+			return nil, fmt.Errorf("DecodeRecurrence: at offset %d: %w", c.errOffset, ErrTruncated)
+		}
+	}
+	return r, nil
+}
+
+// recurString8 reads an 8-bit string of an ExceptionInfo.
+func recurString8(c *leCursor) string {
+	c.uint16() // the length plus one
+	return string(c.next(int(c.uint16())))
+}
+
+// utf16String reads a UTF-16 string with a 16-bit length in characters.
+func utf16String(c *leCursor) string {
+	b := c.next(2 * int(c.uint16()))
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
+
+// inLocation returns the local time t, stored as UTC, as a time in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+var rruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RRule returns the pattern as an iCalendar RRULE value, e.g.
+// "FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE;WKST=SU", or "" if it can't be expressed
+// as one, as for Hijri calendar patterns. loc is the time zone of the
+// appointment, for the UNTIL time.
+func (r *Recurrence) RRule(loc *time.Location) string {
+	return r.rrule(icalTime(inLocation(r.EndDate.Add(r.StartTimeOffset), loc)))
+}
+
+// rrule returns the RRULE value with UNTIL as until.
+func (r *Recurrence) rrule(until string) string {
+	if r.CalendarType > 1 { // not Gregorian
+		return ""
+	}
+	var freq string
+	var by []string
+	interval := r.Period
+	switch r.PatternType {
+	case PatternDay:
+		freq, interval = "DAILY", r.Period/(24*60)
+	case PatternWeek:
+		freq = "WEEKLY"
+		by = append(by, "BYDAY="+r.byDay())
+	case PatternMonth, PatternMonthNth, PatternMonthEnd:
+		freq = "MONTHLY"
+		switch {
+		case r.PatternType == PatternMonthNth:
+			by = append(by, "BYDAY="+r.byDay())
+		case r.PatternType == PatternMonthEnd || r.DayOfMonth >= 31:
+			by = append(by, "BYMONTHDAY=-1")
+		case r.DayOfMonth > 28:
+			// The day is the last one in shorter months.
+			days := []string{"28"}
+			for d := 29; d <= int(r.DayOfMonth); d++ {
+				days = append(days, strconv.Itoa(d))
+			}
+			by = append(by, "BYMONTHDAY="+strings.Join(days, ","))
+		default:
+			by = append(by, "BYMONTHDAY="+strconv.Itoa(int(r.DayOfMonth)))
+		}
+		if r.Frequency == RecurYearly {
+			freq, interval = "YEARLY", r.Period/12
+			by = append(by, "BYMONTH="+strconv.Itoa(int(r.StartDate.Month())))
+		}
+		switch {
+		case r.PatternType == PatternMonthNth && r.N >= 5:
+			by = append(by, "BYSETPOS=-1")
+		case r.PatternType == PatternMonthNth:
+			by = append(by, "BYSETPOS="+strconv.Itoa(int(r.N)))
+		case r.PatternType == PatternMonth && r.DayOfMonth > 28 && r.DayOfMonth < 31:
+			by = append(by, "BYSETPOS=-1")
+		}
+	default:
+		return ""
+	}
+
+	rule := []string{"FREQ=" + freq}
+	switch r.EndType {
+	case RecurEndAfterN:
+		rule = append(rule, "COUNT="+strconv.Itoa(int(r.OccurrenceCount)))
+	case RecurEndAfterDate:
+		rule = append(rule, "UNTIL="+until)
+	}
+	if interval > 1 {
+		rule = append(rule, "INTERVAL="+strconv.Itoa(int(interval)))
+	}
+	rule = append(rule, by...)
+	if r.PatternType == PatternWeek && r.FirstDOW < 7 {
+		rule = append(rule, "WKST="+rruleDays[r.FirstDOW])
+	}
+	return strings.Join(rule, ";")
+}
+
+func (r *Recurrence) byDay() string {
+	var days []string
+	for i, d := range rruleDays {
+		if r.DayOfWeek&(1<<i) != 0 {
+			days = append(days, d)
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+// ExDates returns the start times of the deleted instances, in loc, as for
+// the iCalendar EXDATE. Modified instances are also deleted from the pattern,
+// but they're in Exceptions instead.
+func (r *Recurrence) ExDates(loc *time.Location) []time.Time {
+	var dates []time.Time
+	for _, d := range r.deleted() {
+		dates = append(dates, inLocation(d.Add(r.StartTimeOffset), loc))
+	}
+	return dates
+}
+
+// deleted returns the dates of the deleted instances that aren't modified.
+func (r *Recurrence) deleted() []time.Time {
+	var dates []time.Time
+outer:
+	for _, d := range r.DeletedInstanceDates {
+		for _, e := range r.Exceptions {
+			if e.OriginalStart.Truncate(24 * time.Hour).Equal(d) {
+				continue outer
+			}
+		}
+		dates = append(dates, d)
+	}
+	return dates
+}
+
+// location returns a time zone for the local times of the pattern, with the
+// offset of the first instance, which starts at start. It doesn't know about
+// daylight saving time.
+func (r *Recurrence) location(start time.Time) *time.Location {
+	offset := r.StartDate.Add(r.StartTimeOffset).Sub(start.UTC()).Round(time.Minute)
+	if offset < -14*time.Hour || offset > 14*time.Hour {
+		return time.UTC
+	}
+	return time.FixedZone("", int(offset/time.Second))
+}
@@ -0,0 +1,246 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func minutes(t time.Time) int {
+	return int((t.Unix() + filetimeEpoch) / 60)
+}
+
+// recurPattern encodes r as an AppointmentRecurrencePattern, with
+// ExtendedExceptions for the Unicode subjects and locations.
+func recurPattern(r *Recurrence) []byte {
+	var b bytes.Buffer
+	b.Write(le16(0x3004))
+	b.Write(le16(0x3004))
+	b.Write(le16(int(r.Frequency)))
+	b.Write(le16(int(r.PatternType)))
+	b.Write(le16(int(r.CalendarType)))
+	b.Write(le32(int(r.FirstDateTime)))
+	b.Write(le32(int(r.Period)))
+	b.Write(le32(int(r.SlidingFlag)))
+	switch r.PatternType {
+	case PatternWeek:
+		b.Write(le32(int(r.DayOfWeek)))
+	case PatternMonth, PatternMonthEnd, PatternHjMonth, PatternHjMonthEnd:
+		b.Write(le32(int(r.DayOfMonth)))
+	case PatternMonthNth, PatternHjMonthNth:
+		b.Write(le32(int(r.DayOfWeek)))
+		b.Write(le32(int(r.N)))
+	}
+	b.Write(le32(int(r.EndType)))
+	b.Write(le32(int(r.OccurrenceCount)))
+	b.Write(le32(int(r.FirstDOW)))
+	for _, dates := range [][]time.Time{r.DeletedInstanceDates, r.ModifiedInstanceDates} {
+		b.Write(le32(len(dates)))
+		for _, t := range dates {
+			b.Write(le32(minutes(t)))
+		}
+	}
+	b.Write(le32(minutes(r.StartDate)))
+	b.Write(le32(minutes(r.EndDate)))
+
+	b.Write(le32(0x3006))
+	b.Write(le32(0x3009))
+	b.Write(le32(int(r.StartTimeOffset / time.Minute)))
+	b.Write(le32(int(r.EndTimeOffset / time.Minute)))
+	b.Write(le16(len(r.Exceptions)))
+	for _, e := range r.Exceptions {
+		b.Write(le32(minutes(e.Start)))
+		b.Write(le32(minutes(e.End)))
+		b.Write(le32(minutes(e.OriginalStart)))
+		b.Write(le16(int(e.OverrideFlags)))
+		if e.OverrideFlags&AROSubject != 0 {
+			b.Write(le16(len(e.Subject) + 1))
+			b.Write(le16(len(e.Subject)))
+			b.WriteString(e.Subject)
+		}
+		if e.OverrideFlags&AROLocation != 0 {
+			b.Write(le16(len(e.Location) + 1))
+			b.Write(le16(len(e.Location)))
+			b.WriteString(e.Location)
+		}
+		if e.OverrideFlags&AROBusyStatus != 0 {
+			b.Write(le32(int(e.BusyStatus)))
+		}
+	}
+	b.Write(le32(0)) // ReservedBlock1
+	for _, e := range r.Exceptions {
+		b.Write(le32(4)) // ChangeHighlight
+		b.Write(le32(0))
+		b.Write(le32(0)) // ReservedBlockEE1
+		if e.OverrideFlags&(AROSubject|AROLocation) != 0 {
+			b.Write(le32(minutes(e.Start)))
+			b.Write(le32(minutes(e.End)))
+			b.Write(le32(minutes(e.OriginalStart)))
+			for _, s := range []string{e.Subject, e.Location} {
+				if s == "" {
+					continue
+				}
+				u := utf16.Encode([]rune(s))
+				b.Write(le16(len(u)))
+				for _, c := range u {
+					b.Write(le16(int(c)))
+				}
+			}
+			b.Write(le32(0)) // ReservedBlockEE2
+		}
+	}
+	b.Write(le32(0)) // ReservedBlock2
+	return b.Bytes()
+}
+
+func TestDecodeRecurrence(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	cet := time.FixedZone("CET", 3600)
+
+	tests := []struct {
+		name    string
+		in      *Recurrence
+		rrule   string
+		exdates []time.Time
+	}{
+		{
+			"daily",
+			&Recurrence{
+				Frequency: RecurDaily, PatternType: PatternDay, Period: 3 * 24 * 60,
+				EndType: RecurEndAfterDate, OccurrenceCount: 5,
+				StartDate: day(2018, 11, 6), EndDate: day(2018, 11, 18),
+				StartTimeOffset: 9 * time.Hour, EndTimeOffset: 10 * time.Hour,
+			},
+			"FREQ=DAILY;UNTIL=20181118T080000Z;INTERVAL=3",
+			nil,
+		},
+		{
+			"every weekday",
+			&Recurrence{
+				Frequency: RecurDaily, PatternType: PatternWeek, Period: 1, DayOfWeek: 0x3e,
+				EndType: RecurNoEnd, FirstDOW: 1,
+				StartDate: day(2018, 11, 6), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;WKST=MO",
+			nil,
+		},
+		{
+			"weekly with exceptions",
+			&Recurrence{
+				Frequency: RecurWeekly, PatternType: PatternWeek, Period: 2, DayOfWeek: 0x0a,
+				EndType: RecurEndAfterN, OccurrenceCount: 10,
+				DeletedInstanceDates:  []time.Time{day(2018, 11, 7), day(2018, 11, 19)},
+				ModifiedInstanceDates: []time.Time{day(2018, 11, 20)},
+				StartDate:             day(2018, 11, 5), EndDate: day(2018, 12, 5),
+				StartTimeOffset: 15 * time.Hour, EndTimeOffset: 16 * time.Hour,
+				Exceptions: []RecurrenceException{{
+					Start:         time.Date(2018, 11, 20, 11, 0, 0, 0, time.UTC),
+					End:           time.Date(2018, 11, 20, 12, 0, 0, 0, time.UTC),
+					OriginalStart: time.Date(2018, 11, 19, 15, 0, 0, 0, time.UTC),
+					OverrideFlags: AROSubject | AROLocation | AROBusyStatus,
+					Subject:       "Planung für Q1",
+					Location:      "Raum 2",
+					BusyStatus:    1,
+				}},
+			},
+			"FREQ=WEEKLY;COUNT=10;INTERVAL=2;BYDAY=MO,WE;WKST=SU",
+			[]time.Time{time.Date(2018, 11, 7, 15, 0, 0, 0, cet)},
+		},
+		{
+			"monthly on the 30th",
+			&Recurrence{
+				Frequency: RecurMonthly, PatternType: PatternMonth, Period: 1, DayOfMonth: 30,
+				EndType: RecurNoEnd, StartDate: day(2018, 11, 30), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"FREQ=MONTHLY;BYMONTHDAY=28,29,30;BYSETPOS=-1",
+			nil,
+		},
+		{
+			"last day of every other month",
+			&Recurrence{
+				Frequency: RecurMonthly, PatternType: PatternMonthEnd, Period: 2, DayOfMonth: 31,
+				EndType: RecurEndAfterN, OccurrenceCount: 6, StartDate: day(2018, 11, 30), EndDate: day(2019, 9, 30),
+			},
+			"FREQ=MONTHLY;COUNT=6;INTERVAL=2;BYMONTHDAY=-1",
+			nil,
+		},
+		{
+			"second Tuesday",
+			&Recurrence{
+				Frequency: RecurMonthly, PatternType: PatternMonthNth, Period: 1, DayOfWeek: 0x04, N: 2,
+				EndType: RecurNoEnd, StartDate: day(2018, 11, 13), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"FREQ=MONTHLY;BYDAY=TU;BYSETPOS=2",
+			nil,
+		},
+		{
+			"yearly on the last weekday of March",
+			&Recurrence{
+				Frequency: RecurYearly, PatternType: PatternMonthNth, Period: 12, DayOfWeek: 0x3e, N: 5,
+				EndType: RecurNoEnd, StartDate: day(2019, 3, 29), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"FREQ=YEARLY;BYDAY=MO,TU,WE,TH,FR;BYMONTH=3;BYSETPOS=-1",
+			nil,
+		},
+		{
+			"yearly on a date",
+			&Recurrence{
+				Frequency: RecurYearly, PatternType: PatternMonth, Period: 12, DayOfMonth: 6,
+				EndType: RecurNoEnd, StartDate: day(2018, 11, 6), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"FREQ=YEARLY;BYMONTHDAY=6;BYMONTH=11",
+			nil,
+		},
+		{
+			"Hijri",
+			&Recurrence{
+				Frequency: RecurMonthly, PatternType: PatternHjMonth, CalendarType: 6, Period: 1, DayOfMonth: 1,
+				EndType: RecurNoEnd, StartDate: day(2018, 11, 9), EndDate: minutesToTime(0x5AE980DF),
+			},
+			"",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := DecodeRecurrence(recurPattern(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r, tt.in) {
+				t.Errorf("\ngot  %+v\nwant %+v", r, tt.in)
+			}
+			if rule := r.RRule(cet); rule != tt.rrule {
+				t.Errorf("RRule: %q; want %q", rule, tt.rrule)
+			}
+			if exdates := r.ExDates(cet); !reflect.DeepEqual(exdates, tt.exdates) {
+				t.Errorf("ExDates: %v; want %v", exdates, tt.exdates)
+			}
+		})
+	}
+}
+
+func TestDecodeRecurrenceErrors(t *testing.T) {
+	data := recurPattern(&Recurrence{
+		Frequency: RecurWeekly, PatternType: PatternWeek, Period: 1, DayOfWeek: 0x02,
+		EndType: RecurNoEnd, StartDate: time.Date(2018, 11, 5, 0, 0, 0, 0, time.UTC),
+		Exceptions: []RecurrenceException{{OverrideFlags: AROSubject, Subject: "x"}},
+	})
+
+	// A RecurrencePattern without the appointment part is fine.
+	if r, err := DecodeRecurrence(data[:54]); err != nil || r.PatternType != PatternWeek {
+		t.Errorf("RecurrencePattern: %+v, %v", r, err)
+	}
+	for _, n := range []int{0, 10, 53, 60, 80} {
+		if _, err := DecodeRecurrence(data[:n]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%d bytes: %v", n, err)
+		}
+	}
+	if _, err := DecodeRecurrence(append([]byte{0x06, 0x30}, data[2:]...)); err == nil {
+		t.Error("no error for an unknown version")
+	}
+}
@@ -0,0 +1,147 @@
+package tnef
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	rtfCompressed   = 0x75465a4c // "LZFu"
+	rtfUncompressed = 0x414c454d // "MELA"
+
+	rtfHeaderLength = 16
+	rtfDictSize     = 4096
+)
+
+// rtfPrebuf is the initial content of the dictionary used by the compressed
+// RTF format.
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}" +
+	"{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier" +
+	"{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+// DecompressRTF decompresses an RTF body as stored in the MAPIRtfCompressed
+// property. Both the compressed ("LZFu") and uncompressed ("MELA") formats
+// from [MS-OXRTFCP] are supported; the CRC of compressed data is verified.
+// RTF bodies larger than DefaultLimits.MaxRTFSize are an error.
+func DecompressRTF(data []byte) ([]byte, error) {
+	return decompressRTF(data, DefaultLimits.MaxRTFSize)
+}
+
+// decompressRTF decompresses an RTF body of up to max bytes.
+func decompressRTF(data []byte, max int) ([]byte, error) {
+	/*
+		RTFHeader = COMPSIZE RAWSIZE COMPTYPE CRC
+		COMPSIZE = UINT32 ; size of the data after the COMPSIZE field
+		RAWSIZE = UINT32 ; size of the uncompressed RTF
+		COMPTYPE = "LZFu" / "MELA"
+		CRC = UINT32 ; CRC of the compressed data, 0 for MELA
+	*/
+	if len(data) < rtfHeaderLength {
+		return nil, fmt.Errorf("DecompressRTF: %w", ErrTruncated)
+	}
+	compSize := byteToInt(data[0:4])
+	rawSize := byteToInt(data[4:8])
+	compType := byteToInt(data[8:12])
+	crc := uint32(byteToInt(data[12:16]))
+
+	end := compSize + 4
+	if end > len(data) {
+		return nil, fmt.Errorf("DecompressRTF: compressed size %d: %w", compSize, ErrTruncated)
+	}
+	if end < rtfHeaderLength {
+		return nil, fmt.Errorf("DecompressRTF: compressed size %d is invalid", compSize)
+	}
+	data = data[rtfHeaderLength:end]
+	if rawSize > max {
+		return nil, fmt.Errorf("DecompressRTF: raw size %d: %w", rawSize, limitError("bytes of RTF", max))
+	}
+
+	switch compType {
+	case rtfUncompressed:
+		if rawSize > len(data) {
+			return nil, fmt.Errorf("DecompressRTF: raw size %d is invalid", rawSize)
+		}
+		return data[:rawSize], nil
+	case rtfCompressed:
+		if c := rtfCRC(data); c != crc {
+			return nil, fmt.Errorf("DecompressRTF: CRC %#x instead of %#x: %w", c, crc, ErrChecksum)
+		}
+		out := decompressLZFu(data, rawSize, max)
+		if len(out) > max {
+			return nil, fmt.Errorf("DecompressRTF: %w", limitError("bytes of RTF", max))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("DecompressRTF: compression type %#x is invalid", compType)
+}
+
+// decompressLZFu decompresses the LZFu data after the header. Data is read in
+// runs of 8 tokens preceded by a control byte; a set bit in the control byte
+// (least significant bit first) means the token is a 2 byte dictionary
+// reference instead of a literal byte. It stops once the output is larger than
+// max.
+func decompressLZFu(data []byte, rawSize, max int) []byte {
+	var dict [rtfDictSize]byte
+	copy(dict[:], rtfPrebuf)
+	writePos := len(rtfPrebuf)
+
+	// rawSize is only a hint; it comes from the file.
+	if rawSize > len(data)*8 {
+		rawSize = len(data) * 8
+	}
+	out := make([]byte, 0, rawSize)
+
+	offset := 0
+	for offset < len(data) && len(out) <= max {
+		control := data[offset]
+		offset++
+
+		for bit := 0; bit < 8 && offset < len(data); bit++ {
+			if control&(1<<uint(bit)) == 0 {
+				b := data[offset]
+				offset++
+				out = append(out, b)
+				dict[writePos] = b
+				writePos = (writePos + 1) % rtfDictSize
+				continue
+			}
+
+			if offset+2 > len(data) {
+				return out
+			}
+			// The reference is big endian: 12 bits offset, 4 bits length.
+			ref := int(data[offset])<<8 | int(data[offset+1])
+			offset += 2
+			readPos := ref >> 4
+			length := ref&0xf + 2
+			if readPos == writePos {
+				// End of the compressed data.
+				return out
+			}
+
+			for i := 0; i < length; i++ {
+				b := dict[(readPos+i)%rtfDictSize]
+				out = append(out, b)
+				dict[writePos] = b
+				writePos = (writePos + 1) % rtfDictSize
+			}
+		}
+	}
+	return out
+}
+
+// rtfCRC calculates the CRC of compressed RTF data. It's the standard CRC-32,
+// but without inverting the value at the start and the end.
+func rtfCRC(data []byte) uint32 {
+	return ^crc32.Update(0xffffffff, crc32.IEEETable, data)
+}
+
+// storeRTF stores an RTF body in the uncompressed ("MELA") format, for the
+// MAPIRtfCompressed property.
+func storeRTF(rtf []byte) []byte {
+	b := le32(len(rtf) + rtfHeaderLength - 4)
+	b = append(b, le32(len(rtf))...)
+	b = append(b, le32(rtfUncompressed)...)
+	b = append(b, le32(0)...) // CRC
+	return append(b, rtf...)
+}
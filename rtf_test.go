@@ -0,0 +1,108 @@
+package tnef
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	rtfHeader := func(compSize, rawSize int, compType string, crc uint32) []byte {
+		b := []byte{
+			byte(compSize), byte(compSize >> 8), byte(compSize >> 16), byte(compSize >> 24),
+			byte(rawSize), byte(rawSize >> 8), byte(rawSize >> 16), byte(rawSize >> 24),
+		}
+		b = append(b, compType...)
+		return append(b, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+	}
+
+	// Example from [MS-OXRTFCP] section 3.1.1.
+	compressed := []byte{
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42,
+		0x32, 0x0a, 0xf3, 0x20, 0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77,
+		0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f, 0xa0,
+	}
+	plain := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    string
+		wantErr string
+	}{
+		{"compressed", append(rtfHeader(len(compressed)+12, len(plain), "LZFu", 0xa7c7c5f1), compressed...), plain, ""},
+		{"uncompressed", append(rtfHeader(len(plain)+12, len(plain), "MELA", 0), plain...), plain, ""},
+		{"bad crc", append(rtfHeader(len(compressed)+12, len(plain), "LZFu", 1), compressed...), "", "CRC"},
+		{"bad type", append(rtfHeader(len(plain)+12, len(plain), "XXXX", 0), plain...), "", "compression type"},
+		{"too short", []byte("LZFu"), "", ErrTruncated.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := DecompressRTF(tt.in)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong err\ngot:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(out, []byte(tt.want)) {
+				t.Errorf("wrong output\ngot:  %q\nwant: %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeEncapsulateRTF(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		want     string
+		wantHTML bool
+		wantErr  string
+	}{
+		{
+			"html",
+			`{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl{\f0\fswiss Arial;}}` + "\r\n" +
+				`{\*\htmltag19 <html>}{\*\htmltag2 \par }{\*\htmltag50 <body>}` +
+				`\htmlrtf {\f0\htmlrtf0 Hello \'e9\u8364?\htmlrtf \par\htmlrtf0 }` +
+				`{\*\mhtmltag84 <img src="x.png">}{\*\htmltag84 <img src="cid:x.png">}` +
+				`\htmlrtf \par \htmlrtf0 {\*\htmltag58 </body></html>}}`,
+			"<html>\r\n<body>Hello &#233;&#8364;<img src=\"cid:x.png\"></body></html>",
+			true, "",
+		},
+		{
+			"text",
+			`{\rtf1\ansi\fromtext \deff0{\fonttbl{\f0\fswiss Arial;}}` + "\r\n" +
+				`\uc1\pard\plain\f0 Line 1\par Line\tab 2 \{x\}\par` + "\r\n}\x00",
+			"Line 1\r\nLine\t2 {x}\r\n",
+			false, "",
+		},
+		{
+			"text in cp1252",
+			`{\rtf1\ansi\ansicpg1252\fromtext \deff0 caf\'e9 \'80\par}`,
+			"café €\r\n",
+			false, "",
+		},
+		{
+			"text in cp932",
+			`{\rtf1\ansi\ansicpg932\fromtext \deff0 \'93\'fa\'96{\'7b}\par}`,
+			"日本\r\n",
+			false, "",
+		},
+		{"plain rtf", `{\rtf1\ansi\deff0 Hello\par}`, "", false, ErrNotEncapsulated.Error()},
+		{"not rtf", `<html></html>`, "", false, ErrNotEncapsulated.Error()},
+		{"unbalanced", `{\rtf1\fromtext Hello}}`, "Hello", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, html, err := DeEncapsulateRTF([]byte(tt.in))
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong err\ngot:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if string(out) != tt.want {
+				t.Errorf("wrong output\ngot:  %q\nwant: %q", out, tt.want)
+			}
+			if html != tt.wantHTML {
+				t.Errorf("wrong html: %v", html)
+			}
+		})
+	}
+}
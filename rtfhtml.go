@@ -0,0 +1,324 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrNotEncapsulated signals that an RTF body was not created from an HTML or
+// plain text body, so there is nothing to de-encapsulate.
+var ErrNotEncapsulated = errors.New("RTF body does not contain an encapsulated HTML or text body")
+
+// DeEncapsulateRTF extracts the original body from an RTF body that Outlook
+// created from an HTML (\fromhtml1) or plain text (\fromtext) message, as
+// described in [MS-OXRTFEX]. html reports which of the two it is.
+//
+// Text is converted from the code page of the RTF body (\ansicpg, or 1252 if
+// it's not set). Non-ASCII characters are written as HTML character references
+// in HTML bodies, and as UTF-8 in text bodies.
+func DeEncapsulateRTF(rtf []byte) (body []byte, html bool, err error) {
+	return deEncapsulateRTF(rtf, 1252)
+}
+
+// deEncapsulateRTF is DeEncapsulateRTF with cp as the code page of RTF bodies
+// without \ansicpg.
+func deEncapsulateRTF(rtf []byte, cp int) (body []byte, html bool, err error) {
+	html, text := rtfEncapsulation(rtf)
+	if !html && !text {
+		return nil, false, ErrNotEncapsulated
+	}
+
+	d := rtfDeEncapsulator{rtf: rtf, html: html, codePage: cp}
+	err = d.run()
+	d.flush()
+	if err != nil {
+		return nil, false, err
+	}
+	return d.out.Bytes(), html, nil
+}
+
+// rtfEncapsulation looks for the \fromhtml1 and \fromtext control words, which
+// must be in the RTF header before the first group.
+func rtfEncapsulation(rtf []byte) (html, text bool) {
+	if !bytes.HasPrefix(rtf, []byte(`{\rtf1`)) {
+		return false, false
+	}
+	for i, words := 1, 0; i < len(rtf) && words < 10; i++ {
+		switch rtf[i] {
+		case '{':
+			return false, false
+		case '\\':
+			word, param, hasParam, n := rtfControlWord(rtf[i:])
+			i += n - 1
+			words++
+			switch {
+			case word == "fromhtml" && hasParam && param == 1:
+				return true, false
+			case word == "fromtext":
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// rtfSkipDestinations are destinations with no body content; they're skipped
+// even without the \* marker.
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl":    true,
+	"colortbl":   true,
+	"stylesheet": true,
+	"info":       true,
+	"pict":       true,
+	"object":     true,
+	"header":     true,
+	"footer":     true,
+	"listtable":  true,
+	"pntext":     true,
+	"generator":  true,
+}
+
+// rtfSymbols are control words that stand for a single character.
+var rtfSymbols = map[string]rune{
+	"par":       '\n',
+	"line":      '\n',
+	"tab":       '\t',
+	"emdash":    '—',
+	"endash":    '–',
+	"emspace":   ' ',
+	"enspace":   ' ',
+	"bullet":    '•',
+	"lquote":    '‘',
+	"rquote":    '’',
+	"ldblquote": '“',
+	"rdblquote": '”',
+}
+
+// rtfGroup is the state of the de-encapsulator that's scoped to an RTF group.
+type rtfGroup struct {
+	skip    bool // in a destination that isn't part of the body
+	htmltag bool // in a \*\htmltag destination
+	htmlrtf bool // between \htmlrtf and \htmlrtf0
+	uc      int  // number of fallback characters after \u
+}
+
+type rtfDeEncapsulator struct {
+	rtf      []byte
+	html     bool
+	codePage int
+	out      bytes.Buffer
+	text     []byte // text in codePage that's not written to out yet
+
+	group  rtfGroup
+	stack  []rtfGroup
+	skipUC int // fallback characters still to skip
+}
+
+func (d *rtfDeEncapsulator) run() error {
+	d.group.uc = 1
+	newGroup := false // the last token was a {
+	ignorable := false
+	for i := 0; i < len(d.rtf); i++ {
+		c := d.rtf[i]
+		switch c {
+		case '{':
+			d.stack = append(d.stack, d.group)
+			d.skipUC = 0
+			newGroup = true
+			continue
+		case '}':
+			if len(d.stack) == 0 {
+				return fmt.Errorf("DeEncapsulateRTF: unbalanced group at offset %d", i)
+			}
+			d.group = d.stack[len(d.stack)-1]
+			d.stack = d.stack[:len(d.stack)-1]
+			d.skipUC = 0
+			if len(d.stack) == 0 {
+				// The end of the document.
+				return nil
+			}
+		case '\r', '\n':
+			continue
+		case '\\':
+			if i+1 >= len(d.rtf) {
+				break
+			}
+			switch s := d.rtf[i+1]; {
+			case s == '*':
+				i++
+				ignorable = true
+				continue
+			case s == '\'':
+				if i+3 >= len(d.rtf) {
+					return fmt.Errorf("DeEncapsulateRTF: truncated escape at offset %d", i)
+				}
+				b, err := strconv.ParseUint(string(d.rtf[i+2:i+4]), 16, 8)
+				if err != nil {
+					return fmt.Errorf("DeEncapsulateRTF: invalid escape at offset %d", i)
+				}
+				i += 3
+				d.writeByte(byte(b))
+			case s == '{' || s == '}' || s == '\\':
+				i++
+				d.writeByte(s)
+			case s == '~':
+				i++
+				d.writeRune(' ')
+			case s == '_':
+				i++
+				d.writeRune('‑')
+			case s == '\r' || s == '\n':
+				i++
+				d.writeRune('\n')
+			case isRTFLetter(s):
+				word, param, hasParam, n := rtfControlWord(d.rtf[i:])
+				i += n - 1
+				if newGroup {
+					d.destination(word, ignorable)
+				}
+				d.controlWord(word, param, hasParam)
+			default:
+				// Other control symbols, like \- (optional hyphen).
+				i++
+			}
+		default:
+			d.writeByte(c)
+		}
+		newGroup = false
+		ignorable = false
+	}
+	return nil
+}
+
+// destination handles the first control word of a group.
+func (d *rtfDeEncapsulator) destination(word string, ignorable bool) {
+	switch {
+	case ignorable && word == "htmltag":
+		d.group.htmltag = true
+	case ignorable, rtfSkipDestinations[word]:
+		// This includes \*\mhtmltag, which holds the original version of a
+		// tag whose URL was changed to a CID in the \*\htmltag.
+		d.group.skip = true
+	}
+}
+
+func (d *rtfDeEncapsulator) controlWord(word string, param int, hasParam bool) {
+	switch word {
+	case "htmlrtf":
+		d.group.htmlrtf = !hasParam || param != 0
+	case "ansicpg":
+		if param > 0 {
+			d.codePage = param
+		}
+	case "uc":
+		d.group.uc = param
+	case "u":
+		if param < 0 {
+			param += 0x10000
+		}
+		d.writeRune(rune(param))
+		d.skipUC = d.group.uc
+		return
+	default:
+		if r, ok := rtfSymbols[word]; ok {
+			if r == '\n' {
+				d.writeString("\r\n")
+			} else {
+				d.writeRune(r)
+			}
+		}
+	}
+	d.skipUC = 0
+}
+
+// visible reports if text at the current position is part of the body.
+func (d *rtfDeEncapsulator) visible() bool {
+	if d.group.skip {
+		return false
+	}
+	return d.group.htmltag || !d.group.htmlrtf
+}
+
+// writeByte writes a byte of text in the code page of the RTF body. It's
+// buffered, as a character can take more than one byte, each of which may be
+// a \'xx escape.
+func (d *rtfDeEncapsulator) writeByte(b byte) {
+	if d.skipUC > 0 {
+		d.skipUC--
+		return
+	}
+	if d.visible() {
+		d.text = append(d.text, b)
+	}
+}
+
+func (d *rtfDeEncapsulator) writeString(s string) {
+	if d.visible() {
+		d.flush()
+		d.out.WriteString(s)
+	}
+}
+
+func (d *rtfDeEncapsulator) writeRune(r rune) {
+	if d.visible() {
+		d.flush()
+		d.putRune(r)
+	}
+}
+
+// flush converts the buffered text to UTF-8 and writes it.
+func (d *rtfDeEncapsulator) flush() {
+	if len(d.text) == 0 {
+		return
+	}
+	for _, r := range decodeString8(d.codePage, string(d.text)) {
+		d.putRune(r)
+	}
+	d.text = d.text[:0]
+}
+
+func (d *rtfDeEncapsulator) putRune(r rune) {
+	switch {
+	case r < utf8.RuneSelf:
+		d.out.WriteByte(byte(r))
+	case d.html:
+		fmt.Fprintf(&d.out, "&#%d;", r)
+	default:
+		d.out.WriteRune(r)
+	}
+}
+
+// rtfControlWord parses the control word at the start of data, which must
+// begin with a backslash. n is the number of bytes used, including the
+// optional space delimiter.
+func rtfControlWord(data []byte) (word string, param int, hasParam bool, n int) {
+	n = 1
+	for n < len(data) && isRTFLetter(data[n]) {
+		n++
+	}
+	word = string(data[1:n])
+
+	start := n
+	if n < len(data) && data[n] == '-' {
+		n++
+	}
+	for n < len(data) && data[n] >= '0' && data[n] <= '9' {
+		n++
+	}
+	if n > start {
+		param, _ = strconv.Atoi(string(data[start:n]))
+		hasParam = true
+	}
+
+	if n < len(data) && data[n] == ' ' {
+		n++
+	}
+	return word, param, hasParam, n
+}
+
+func isRTFLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,383 @@
+package tnef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SystemTime is a Windows SYSTEMTIME, as used for the transitions of a
+// TimeZoneRule. If Year is 0, the transition is every year on the Day'th
+// DayOfWeek of Month, where a Day of 5 is the last one; the time is the local
+// time before the transition. A Month of 0 means there is no transition.
+type SystemTime struct {
+	Year, Month, DayOfWeek, Day        uint16
+	Hour, Minute, Second, Milliseconds uint16
+}
+
+// TimeZoneRule is the bias of a time zone and its daylight saving time from
+// a year on. The biases are in minutes, with UTC = local time + bias.
+type TimeZoneRule struct {
+	Year         int
+	Flags        uint16 // TZRuleEffective, TZRuleRecurCurrent
+	Bias         int32
+	StandardBias int32
+	DaylightBias int32
+	StandardDate SystemTime // the start of standard time
+	DaylightDate SystemTime // the start of daylight saving time
+}
+
+// Flags of a TimeZoneRule in a TZDEFINITION.
+const (
+	TZRuleRecurCurrent = 0x0001
+	TZRuleEffective    = 0x0002
+)
+
+// TimeZone is the time zone of an appointment from [MS-OXOCAL], as stored in
+// PidLidTimeZoneStruct or a TZDEFINITION, like
+// PidLidAppointmentTimeZoneDefinitionStartDisplay.
+type TimeZone struct {
+	Name  string         // e.g. "W. Europe Standard Time"
+	Rules []TimeZoneRule // sorted by year
+}
+
+// DecodeTimeZoneStruct decodes a time zone as stored in PidLidTimeZoneStruct.
+// It doesn't have a name; PidLidTimeZoneDescription has it.
+func DecodeTimeZoneStruct(data []byte) (*TimeZone, error) {
+	/**
+	TimeZoneStruct = lBias lStandardBias lDaylightBias
+	                 wStandardYear stStandardDate wDaylightYear stDaylightDate
+	lBias, lStandardBias, lDaylightBias = INT32
+	wStandardYear, wDaylightYear = UINT16
+	stStandardDate, stDaylightDate = SYSTEMTIME
+	*/
+	c := leCursor{data: data}
+	r := TimeZoneRule{
+		Bias:         int32(c.uint32()),
+		StandardBias: int32(c.uint32()),
+		DaylightBias: int32(c.uint32()),
+	}
+	c.uint16() // wStandardYear
+	r.StandardDate = decodeSystemTime(&c)
+	c.uint16() // wDaylightYear
+	r.DaylightDate = decodeSystemTime(&c)
+	if c.err {
+		return nil, fmt.Errorf("DecodeTimeZoneStruct: at offset %d: %w", c.errOffset, ErrTruncated)
+	}
+	return &TimeZone{Rules: []TimeZoneRule{r}}, nil
+}
+
+// DecodeTimeZoneDefinition decodes a time zone as stored in a TZDEFINITION,
+// like PidLidAppointmentTimeZoneDefinitionStartDisplay.
+func DecodeTimeZoneDefinition(data []byte) (*TimeZone, error) {
+	/**
+	TZDEFINITION = bMajorVersion bMinorVersion cbHeader wReserved
+	               cchKeyName KeyName cRules *TZRULE
+	bMajorVersion = 0x02 (BYTE)
+	bMinorVersion = BYTE
+	cbHeader = UINT16 ; size of the fields from wReserved to cRules
+	cchKeyName = UINT16
+	KeyName = *WCHAR
+	cRules = UINT16
+
+	TZRULE = bMajorVersion bMinorVersion wReserved wTZRuleFlags wYear X
+	         lBias lStandardBias lDaylightBias stStandardDate stDaylightDate
+	X = 14*BYTE
+	*/
+	c := leCursor{data: data}
+	if v := c.next(1); v != nil && v[0] != 0x02 {
+		return nil, fmt.Errorf("DecodeTimeZoneDefinition: unknown version %d", v[0])
+	}
+	c.next(1)
+	header := int(c.uint16())
+	end := c.offset + header
+	c.uint16() // wReserved
+	z := &TimeZone{Name: utf16String(&c)}
+	n := int(c.uint16())
+	if !c.err && c.offset > end {
+		return nil, fmt.Errorf("DecodeTimeZoneDefinition: header size %d is invalid", header)
+	}
+	c.next(end - c.offset)
+	if !c.err && n > c.remaining()/66 {
+		c.err, c.errOffset = true, c.offset
+	}
+	for i := 0; i < n && !c.err; i++ {
+		c.next(4) // versions and wReserved
+		r := TimeZoneRule{Flags: c.uint16(), Year: int(c.uint16())}
+		c.next(14)
+		r.Bias = int32(c.uint32())
+		r.StandardBias = int32(c.uint32())
+		r.DaylightBias = int32(c.uint32())
+		r.StandardDate = decodeSystemTime(&c)
+		r.DaylightDate = decodeSystemTime(&c)
+		z.Rules = append(z.Rules, r)
+	}
+	if c.err {
+		return nil, fmt.Errorf("DecodeTimeZoneDefinition: at offset %d: %w", c.errOffset, ErrTruncated)
+	}
+	if len(z.Rules) == 0 {
+		return nil, fmt.Errorf("DecodeTimeZoneDefinition: no rules")
+	}
+	sort.SliceStable(z.Rules, func(i, j int) bool { return z.Rules[i].Year < z.Rules[j].Year })
+	return z, nil
+}
+
+func decodeSystemTime(c *leCursor) SystemTime {
+	return SystemTime{
+		Year: c.uint16(), Month: c.uint16(), DayOfWeek: c.uint16(), Day: c.uint16(),
+		Hour: c.uint16(), Minute: c.uint16(), Second: c.uint16(), Milliseconds: c.uint16(),
+	}
+}
+
+// TimeZone returns the time zone of an appointment or meeting request, from
+// PidLidAppointmentTimeZoneDefinitionStartDisplay,
+// PidLidAppointmentTimeZoneDefinitionRecur or PidLidTimeZoneStruct, or nil if
+// there isn't one.
+func (d *Data) TimeZone() (*TimeZone, error) {
+	for _, name := range []string{
+		"PidLidAppointmentTimeZoneDefinitionStartDisplay",
+		"PidLidAppointmentTimeZoneDefinitionRecur",
+	} {
+		if data, ok := d.namedBinary(name); ok && len(data) > 0 {
+			return DecodeTimeZoneDefinition(data)
+		}
+	}
+	data, ok := d.namedBinary("PidLidTimeZoneStruct")
+	if !ok {
+		return nil, nil
+	}
+	z, err := DecodeTimeZoneStruct(data)
+	if err != nil {
+		return nil, err
+	}
+	z.Name, _ = d.namedString("PidLidTimeZoneDescription")
+	return z, nil
+}
+
+// rule returns the rule for year: the last one from before it, or the first
+// one.
+func (z *TimeZone) rule(year int) *TimeZoneRule {
+	r := &z.Rules[0]
+	for i := range z.Rules {
+		if z.Rules[i].Year <= year {
+			r = &z.Rules[i]
+		}
+	}
+	return r
+}
+
+// standard and daylight return the offsets of the rule in seconds east of UTC.
+func (r *TimeZoneRule) standard() int { return -int(r.Bias+r.StandardBias) * 60 }
+func (r *TimeZoneRule) daylight() int { return -int(r.Bias+r.DaylightBias) * 60 }
+
+// hasDaylight reports if the rule has daylight saving time.
+func (r *TimeZoneRule) hasDaylight() bool {
+	return r.StandardDate.Month != 0 && r.DaylightDate.Month != 0
+}
+
+// local returns the local time of the transition in year, if there is one.
+func (st SystemTime) local(year int) (time.Time, bool) {
+	if st.Month < 1 || st.Month > 12 || st.Year != 0 && int(st.Year) != year {
+		return time.Time{}, false
+	}
+	m := time.Month(st.Month)
+	day := int(st.Day)
+	if st.Year == 0 {
+		first := time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+		day = 1 + (int(st.DayOfWeek)-int(first.Weekday())+7)%7 + 7*(day-1)
+		for day > first.AddDate(0, 1, -1).Day() {
+			day -= 7
+		}
+	}
+	return time.Date(year, m, day, int(st.Hour), int(st.Minute), int(st.Second), 0, time.UTC), true
+}
+
+// transitions returns the starts of daylight saving and standard time in
+// year, if the rule has them.
+func (r *TimeZoneRule) transitions(year int) (dst, std time.Time, ok bool) {
+	if !r.hasDaylight() {
+		return dst, std, false
+	}
+	dst, ok1 := r.DaylightDate.local(year)
+	std, ok2 := r.StandardDate.local(year)
+	if !ok1 || !ok2 {
+		return dst, std, false
+	}
+	dst = dst.Add(-time.Duration(r.standard()) * time.Second)
+	std = std.Add(-time.Duration(r.daylight()) * time.Second)
+	return dst, std, true
+}
+
+// Offset returns the offset of the time zone at t in seconds east of UTC, and
+// if it's daylight saving time; like the offset of t.Zone.
+func (z *TimeZone) Offset(t time.Time) (offset int, isDST bool) {
+	t = t.UTC()
+	r := z.rule(t.Year())
+	dst, std, ok := r.transitions(t.Year())
+	switch {
+	case !ok:
+	case dst.Before(std) && !t.Before(dst) && t.Before(std),
+		dst.After(std) && (t.Before(std) || !t.Before(dst)):
+		return r.daylight(), true
+	}
+	return r.standard(), false
+}
+
+// Location returns the time zone as a *time.Location, so times can be
+// converted with time.Time.In.
+func (z *TimeZone) Location() *time.Location {
+	loc, err := time.LoadLocationFromTZData(z.Name, z.tzif())
+	if err != nil {
+		// Shouldn't happen; tzif creates valid data.
+		return time.FixedZone(z.Name, z.Rules[len(z.Rules)-1].standard())
+	}
+	return loc
+}
+
+// tzif returns the time zone in the TZif format of RFC 8536, which is how
+// a time.Location with rules can be created. The transitions up to the year
+// of the last rule are listed, and the last rule is in the footer as a POSIX
+// TZ string.
+func (z *TimeZone) tzif() []byte {
+	type ttinfo struct {
+		offset int
+		isDST  bool
+	}
+	type transition struct {
+		at   int64
+		info int
+	}
+	var infos []ttinfo
+	index := func(offset int, isDST bool) int {
+		for i, t := range infos {
+			if t == (ttinfo{offset, isDST}) {
+				return i
+			}
+		}
+		infos = append(infos, ttinfo{offset, isDST})
+		return len(infos) - 1
+	}
+
+	first, last := z.Rules[0], z.Rules[len(z.Rules)-1]
+	index(first.standard(), false)
+	var trans []transition
+	if len(z.Rules) > 1 {
+		from, to := first.Year, last.Year
+		if from < 1970 {
+			from = 1970
+		}
+		if to > 2100 {
+			to = 2100
+		}
+		prev := first.standard()
+		for year := from; year <= to; year++ {
+			r := z.rule(year)
+			if r.standard() != prev {
+				at := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).Unix() - int64(prev)
+				trans = append(trans, transition{at, index(r.standard(), false)})
+				prev = r.standard()
+			}
+			if dst, std, ok := r.transitions(year); ok {
+				trans = append(trans,
+					transition{dst.Unix(), index(r.daylight(), true)},
+					transition{std.Unix(), index(r.standard(), false)})
+			}
+		}
+		sort.SliceStable(trans, func(i, j int) bool { return trans[i].at < trans[j].at })
+	}
+
+	var abbrevs bytes.Buffer
+	abbrevIndex := make([]int, len(infos))
+	for i, t := range infos {
+		abbrevIndex[i] = abbrevs.Len()
+		abbrevs.WriteString(tzAbbrev(t.offset) + "\x00")
+	}
+
+	var b bytes.Buffer
+	header := func(timecnt, typecnt, charcnt int) {
+		b.WriteString("TZif2")
+		b.Write(make([]byte, 15))
+		for _, n := range []int{0, 0, 0, timecnt, typecnt, charcnt} { // isut, isstd, leap, ...
+			binary.Write(&b, binary.BigEndian, uint32(n))
+		}
+	}
+	// The version 1 data, which is skipped, and the version 2 data.
+	header(0, 1, 1)
+	b.Write([]byte{0, 0, 0, 0, 0, 0, 0})
+	header(len(trans), len(infos), abbrevs.Len())
+	for _, t := range trans {
+		binary.Write(&b, binary.BigEndian, t.at)
+	}
+	for _, t := range trans {
+		b.WriteByte(byte(t.info))
+	}
+	for i, t := range infos {
+		binary.Write(&b, binary.BigEndian, int32(t.offset))
+		if t.isDST {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		b.WriteByte(byte(abbrevIndex[i]))
+	}
+	b.Write(abbrevs.Bytes())
+	b.WriteString("\n" + last.posix() + "\n")
+	return b.Bytes()
+}
+
+// posix returns the rule as a POSIX TZ string, e.g.
+// "<+01>-1<+02>,M3.5.0/2,M10.5.0/3".
+func (r *TimeZoneRule) posix() string {
+	s := "<" + tzAbbrev(r.standard()) + ">" + posixOffset(r.standard())
+	if !r.hasDaylight() || r.StandardDate.Year != 0 || r.DaylightDate.Year != 0 {
+		return s
+	}
+	return s + "<" + tzAbbrev(r.daylight()) + ">" + posixOffset(r.daylight()) +
+		"," + r.DaylightDate.posix() + "," + r.StandardDate.posix()
+}
+
+func (st SystemTime) posix() string {
+	return fmt.Sprintf("M%d.%d.%d/%d:%02d:%02d", st.Month, st.Day, st.DayOfWeek, st.Hour, st.Minute, st.Second)
+}
+
+// posixOffset returns an offset in seconds east of UTC as in a POSIX TZ
+// string, where it's the other way around.
+func posixOffset(offset int) string {
+	s := ""
+	if offset > 0 {
+		s = "-"
+	} else {
+		offset = -offset
+	}
+	s += strconv.Itoa(offset / 3600)
+	if m := offset % 3600 / 60; m != 0 {
+		s += fmt.Sprintf(":%02d", m)
+	}
+	return s
+}
+
+// tzAbbrev returns the name of an offset, e.g. "+01" or "-0330", as tzdata
+// uses for zones without an abbreviation.
+func tzAbbrev(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	s := fmt.Sprintf("%s%02d", sign, offset/3600)
+	if m := offset % 3600 / 60; m != 0 {
+		s += fmt.Sprintf("%02d", m)
+	}
+	return s
+}
+
+// tzid returns the TZID of the time zone; the name, or the offset if there
+// isn't one.
+func (z *TimeZone) tzid() string {
+	if z.Name != "" {
+		return z.Name
+	}
+	return "UTC" + icalOffset(z.Rules[len(z.Rules)-1].standard())
+}
@@ -0,0 +1,213 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func systemTime(st SystemTime) []byte {
+	var b bytes.Buffer
+	for _, v := range []uint16{st.Year, st.Month, st.DayOfWeek, st.Day, st.Hour, st.Minute, st.Second, st.Milliseconds} {
+		b.Write(le16(int(v)))
+	}
+	return b.Bytes()
+}
+
+// tzDefinition encodes a TZDEFINITION.
+func tzDefinition(name string, rules ...TimeZoneRule) []byte {
+	var b bytes.Buffer
+	u := utf16.Encode([]rune(name))
+	b.Write([]byte{0x02, 0x01})
+	b.Write(le16(6 + 2*len(u)))
+	b.Write(le16(0x0002))
+	b.Write(le16(len(u)))
+	for _, c := range u {
+		b.Write(le16(int(c)))
+	}
+	b.Write(le16(len(rules)))
+	for _, r := range rules {
+		b.Write([]byte{0x02, 0x01})
+		b.Write(le16(0x003e))
+		b.Write(le16(int(r.Flags)))
+		b.Write(le16(r.Year))
+		b.Write(make([]byte, 14))
+		b.Write(le32(int(r.Bias)))
+		b.Write(le32(int(r.StandardBias)))
+		b.Write(le32(int(r.DaylightBias)))
+		b.Write(systemTime(r.StandardDate))
+		b.Write(systemTime(r.DaylightDate))
+	}
+	return b.Bytes()
+}
+
+// westEurope is the rule of W. Europe Standard Time, from the last Sunday of
+// March at 2:00 to the last Sunday of October at 3:00.
+var westEurope = TimeZoneRule{
+	Flags: TZRuleEffective | TZRuleRecurCurrent, Year: 2007,
+	Bias: -60, DaylightBias: -60,
+	StandardDate: SystemTime{Month: 10, DayOfWeek: 0, Day: 5, Hour: 3},
+	DaylightDate: SystemTime{Month: 3, DayOfWeek: 0, Day: 5, Hour: 2},
+}
+
+func TestTimeZone(t *testing.T) {
+	type offset struct {
+		t      time.Time
+		offset int
+		isDST  bool
+	}
+	utc := func(y int, m time.Month, d, h, min, s int) time.Time {
+		return time.Date(y, m, d, h, min, s, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    *TimeZone
+		offsets []offset
+	}{
+		{
+			"W. Europe",
+			tzDefinition("W. Europe Standard Time", westEurope),
+			&TimeZone{Name: "W. Europe Standard Time", Rules: []TimeZoneRule{westEurope}},
+			[]offset{
+				{utc(2018, 1, 15, 12, 0, 0), 3600, false},
+				{utc(2018, 3, 25, 0, 59, 59), 3600, false},
+				{utc(2018, 3, 25, 1, 0, 0), 7200, true},
+				{utc(2018, 10, 28, 0, 59, 59), 7200, true},
+				{utc(2018, 10, 28, 1, 0, 0), 3600, false},
+				{utc(2040, 7, 1, 0, 0, 0), 7200, true},
+			},
+		},
+		{
+			"southern hemisphere",
+			tzDefinition("AUS Eastern Standard Time", TimeZoneRule{
+				Bias: -600, DaylightBias: -60,
+				StandardDate: SystemTime{Month: 4, DayOfWeek: 0, Day: 1, Hour: 3},
+				DaylightDate: SystemTime{Month: 10, DayOfWeek: 0, Day: 1, Hour: 2},
+			}),
+			nil,
+			[]offset{
+				{utc(2018, 1, 15, 0, 0, 0), 39600, true},
+				{utc(2018, 3, 31, 15, 59, 59), 39600, true},
+				{utc(2018, 3, 31, 16, 0, 0), 36000, false},
+				{utc(2018, 7, 1, 0, 0, 0), 36000, false},
+				{utc(2018, 10, 6, 16, 0, 0), 39600, true},
+			},
+		},
+		{
+			"rules for some years",
+			// Russia stopped daylight saving time in 2011, and moved
+			// back an hour in 2014.
+			tzDefinition("Russian Standard Time",
+				TimeZoneRule{Year: 2014, Bias: -180},
+				TimeZoneRule{
+					Bias: -180, DaylightBias: -60,
+					StandardDate: SystemTime{Month: 10, DayOfWeek: 0, Day: 5, Hour: 3},
+					DaylightDate: SystemTime{Month: 3, DayOfWeek: 0, Day: 5, Hour: 2},
+				},
+				TimeZoneRule{Year: 2011, Bias: -240},
+			),
+			nil,
+			[]offset{
+				{utc(2010, 1, 1, 0, 0, 0), 10800, false},
+				{utc(2010, 7, 1, 0, 0, 0), 14400, true},
+				{utc(2012, 1, 1, 0, 0, 0), 14400, false},
+				{utc(2013, 7, 1, 0, 0, 0), 14400, false},
+				{utc(2014, 1, 1, 0, 0, 0), 10800, false},
+				{utc(2018, 7, 1, 0, 0, 0), 10800, false},
+			},
+		},
+		{
+			"TimeZoneStruct",
+			append(append([]byte{
+				0x88, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0xc4, 0xff, 0xff, 0xff, 0, 0,
+			}, systemTime(westEurope.StandardDate)...), append([]byte{0, 0}, systemTime(westEurope.DaylightDate)...)...),
+			&TimeZone{Rules: []TimeZoneRule{{
+				Bias: -120, DaylightBias: -60,
+				StandardDate: westEurope.StandardDate, DaylightDate: westEurope.DaylightDate,
+			}}},
+			[]offset{
+				{utc(2018, 1, 15, 12, 0, 0), 7200, false},
+				{utc(2018, 7, 15, 12, 0, 0), 10800, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode := DecodeTimeZoneDefinition
+			if tt.name == "TimeZoneStruct" {
+				decode = DecodeTimeZoneStruct
+			}
+			z, err := decode(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(z, tt.want) {
+				t.Errorf("\ngot  %+v\nwant %+v", z, tt.want)
+			}
+			loc := z.Location()
+			for _, o := range tt.offsets {
+				if offset, isDST := z.Offset(o.t); offset != o.offset || isDST != o.isDST {
+					t.Errorf("Offset(%v): %d, %v; want %d, %v", o.t, offset, isDST, o.offset, o.isDST)
+				}
+				if _, offset := o.t.In(loc).Zone(); offset != o.offset {
+					t.Errorf("Location at %v: %d; want %d", o.t, offset, o.offset)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeZoneErrors(t *testing.T) {
+	data := tzDefinition("W. Europe Standard Time", westEurope)
+	for _, n := range []int{0, 3, 20, len(data) - 1} {
+		if _, err := DecodeTimeZoneDefinition(data[:n]); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%d bytes: %v", n, err)
+		}
+	}
+	if _, err := DecodeTimeZoneStruct(make([]byte, 47)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("TimeZoneStruct: %v", err)
+	}
+	if _, err := DecodeTimeZoneDefinition(append([]byte{0x01}, data[1:]...)); err == nil {
+		t.Error("no error for an unknown version")
+	}
+	if _, err := DecodeTimeZoneDefinition(tzDefinition("None")); err == nil {
+		t.Error("no error without rules")
+	}
+}
+
+func TestEncodeVTimezone(t *testing.T) {
+	want := strings.Join([]string{
+		"BEGIN:VTIMEZONE",
+		`TZID:(UTC+01:00) Amsterdam\, Berlin\, Bern`,
+		"BEGIN:STANDARD",
+		"DTSTART:16011028T030000",
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:16010325T020000",
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0200",
+		"END:DAYLIGHT",
+		"END:VTIMEZONE",
+		"",
+	}, "\r\n")
+
+	z := &TimeZone{Name: "(UTC+01:00) Amsterdam, Berlin, Bern", Rules: []TimeZoneRule{westEurope}}
+	var buf bytes.Buffer
+	if err := z.EncodeVTimezone(&buf, 2018); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -4,18 +4,20 @@ package tnef
 import (
 	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
+	"math"
 	"path"
 	"strings"
+	"time"
 	//"unicode/utf8"
-	"fmt"
 	"regexp"
 	// "encoding/hex"
 )
 
 const (
 	tnefSignature = 0x223e9f78
-	//lvlMessage    = 0x01
+	lvlMessage    = 0x01
 	lvlAttachment = 0x02
 )
 
@@ -57,11 +59,10 @@ const (
 )
 
 type tnefObject struct {
-	Level  int
-	Name   int
-	Type   int
-	Data   []byte
-	Length int
+	Attribute
+	Offset   int // offset of the object in the TNEF stream
+	Length   int
+	Checksum uint16
 }
 
 // Attachment contains standard attachments that are embedded
@@ -70,21 +71,38 @@ type Attachment struct {
 	Title      string
 	Data       []byte
 	Properties MsgPropertyList
+
+	// CreationTime and LastModificationTime are the dates of the attached
+	// file, from the attachment attributes or properties.
+	CreationTime         time.Time
+	LastModificationTime time.Time
+
+	// EmbeddedMessage is the decoded message of an AttachEmbeddedMsg
+	// attachment, e.g. a forwarded e-mail.
+	EmbeddedMessage *Data
+
+	r io.Reader // streamed data, set by Decoder.NextAttachment
+}
+
+// Open returns a reader for the data of the attachment.
+//
+// Attachments from Decoder.NextAttachment have no Data; their data is streamed
+// from the Decoder's reader instead, and can be read once until the next call
+// to NextAttachment.
+func (a *Attachment) Open() io.Reader {
+	if a.r != nil {
+		return a.r
+	}
+	return bytes.NewReader(a.Data)
 }
 
 func (a *Attachment) setTitleFromPropsIfNeeded() {
 	if a.Title != "" {
 		return
 	}
-	for _, p := range a.Properties.Values {
-		if p.TagId != MAPIAttachFilename && p.TagId != MAPIAttachLongFilename {
-			continue
-		}
-		if p.DataType != "string" {
-			// just in case
-			continue
-		}
-		s := p.Data.(string)
+	// Prefer the long file name; the short one is the 8.3 version of it.
+	for _, tag := range []int{MAPIAttachLongFilename, MAPIAttachFilename} {
+		s := a.Properties.getString(tag)
 		if s == "" {
 			continue
 		}
@@ -96,12 +114,61 @@ func (a *Attachment) setTitleFromPropsIfNeeded() {
 	}
 }
 
+// setDataFromProps uses the data stored in the attachment properties if there
+// was no attAttachData attribute.
+func (a *Attachment) setDataFromProps() {
+	if a.Data != nil || a.attachMethod() != AttachByValue {
+		return
+	}
+	if b, ok := a.GetBinary(MAPIAttachDataObj); ok {
+		a.Data = b
+	}
+}
+
+// attachMethod returns the MAPIAttachMethod property, or 0 if it's not set.
+func (a *Attachment) attachMethod() int {
+	m, _ := a.GetInt32(MAPIAttachMethod)
+	return int(m)
+}
+
+// decodeEmbedded decodes the message stored in an AttachEmbeddedMsg
+// attachment into EmbeddedMessage.
+func (a *Attachment) decodeEmbedded(o DecodeOptions, l *limiter, depth int) error {
+	if a.attachMethod() != AttachEmbeddedMsg || l.MaxEmbeddedDepth < 0 {
+		return nil
+	}
+	// The TNEF stream of the message is stored after the IID of the
+	// object, which should be IID_IMessage.
+	data, ok := a.GetBinary(MAPIAttachDataObj)
+	if !ok || len(data) < 16 {
+		return nil
+	}
+	if depth >= l.MaxEmbeddedDepth && hasSignature(data[16:]) {
+		return limitError("levels of embedded messages", l.MaxEmbeddedDepth)
+	}
+	msg, err := o.decode(data[16:], l, depth+1)
+	if err == ErrNoMarker {
+		// Not in TNEF format; the data is still available in the
+		// properties.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	a.EmbeddedMessage = msg
+	if a.Title == "" {
+		a.Title = msg.Subject
+	}
+	return nil
+}
+
 /**
  * get a mapi attribute
- * @param  {[type]} c *Data)        GetMapiAttribute(attrId int) (attr *MAPIAttribute [description]
+ * @param  {[type]} c *Data)        GetMapiAttribute(attrId int) (attr *Property [description]
  * @return {[type]}   [description]
  */
-func (c *Attachment) GetMapiAttribute(attrId int) (attr *MsgPropertyValue) {
+func (c *Attachment) GetMapiAttribute(attrId int) (attr *Property) {
 	if len(c.Properties.Values) > 0 {
 		for _, a := range c.Properties.Values {
 			if int(a.TagId) == attrId {
@@ -118,46 +185,126 @@ func (c *Attachment) GetMapiAttribute(attrId int) (attr *MsgPropertyValue) {
 // .tnef extension, or a wrong MIME type).
 var ErrNoMarker = errors.New("file did not begin with a TNEF marker")
 
-type MsgPropertyValue struct {
-	TagType uint16
-	TagId   uint16
+// Property is a MAPI property of the message, an attachment or a recipient.
+// Compare TagId to the MAPI* constants to find out what property it is.
+type Property struct {
+	TagType uint16 // the type, e.g. 0x001f for a Unicode string; see mvFlag
+	TagId   uint16 // named properties have an id of 0x8000 or more
 
-	PropNameSpace []byte
+	// The name of a named property: the GUID of its property set, and
+	// either a numeric id (PropIDType 0) or a string (PropIDType 1).
+	PropNameSpace GUID
 	PropIDType    uint32
 	PropMap       []byte // depend by Prop Id Type
 
 	Data      interface{}
 	DataCount uint32 // the number of elements from Data
 	DataType  string
+
+	// Raw is the value of a single valued property as it's stored, without
+	// the length and padding, e.g. the undecoded bytes of a string.
+	Raw []byte
 }
+
+// MsgPropertyValue is the old name of Property.
+//
+// Deprecated: use Property.
+type MsgPropertyValue = Property
+
+// MsgPropertyList is a list of MAPI properties.
 type MsgPropertyList struct {
-	Values []*MsgPropertyValue
+	Values []*Property
+}
+
+// get returns the first value with the given tag, or nil if there is none.
+func (l MsgPropertyList) get(tagID int) *Property {
+	for _, v := range l.Values {
+		if int(v.TagId) == tagID {
+			return v
+		}
+	}
+	return nil
+}
+
+// getString returns the value with the given tag if it's a string, or "".
+func (l MsgPropertyList) getString(tagID int) string {
+	s, _ := l.GetString(tagID)
+	return s
 }
 
 // Data contains the various data from the extracted TNEF file.
 type Data struct {
-	Body         []byte
+	Body         []byte // the plain text body, in UTF-8
 	BodyHTML     []byte
+	BodyRTF      []byte
 	Attachments  []*Attachment
-	Attributes   []MAPIAttribute
+	Properties   MsgPropertyList
 	MessageClass []byte
+	Recipients   []Recipient
+
+	// Attributes are the message properties in Properties, in the format of
+	// earlier versions. Encode doesn't use them.
+	//
+	// Deprecated: use Properties.
+	Attributes []MAPIAttribute
+
+	// Message attributes, as written by older Exchange and Outlook
+	// versions; newer versions may only use the MAPI properties in
+	// Properties.
+	From           Address
+	Subject        string
+	DateSent       time.Time
+	DateReceived   time.Time
+	DateModified   time.Time
+	DateStart      time.Time // of an appointment or meeting
+	DateEnd        time.Time
+	MessageStatus  MessageStatus
+	MessageID      string
+	ParentID       string
+	ConversationID string
+	Priority       Priority
+	TNEFVersion    uint32
+
+	// OEMCodePage is the code page of the 8-bit strings in the attributes,
+	// from attOemCodepage; see also CodePage. Strings are converted to
+	// UTF-8 if the code page is known.
+	OEMCodePage int
+
+	// Dates from the MAPI properties, in UTC.
+	ClientSubmitTime     time.Time // when the message was sent
+	MessageDeliveryTime  time.Time // when the message was received
+	CreationTime         time.Time
+	LastModificationTime time.Time
+
+	// Warnings are problems that didn't stop decoding, like attributes
+	// with the wrong checksum. They're errors in strict mode.
+	Warnings []error
+
+	// Skipped are the parts of the stream that were skipped in recovery
+	// mode, because they couldn't be decoded.
+	Skipped []ByteRange
+}
+
+// ByteRange is a range of bytes in a TNEF stream.
+type ByteRange struct {
+	Offset int
+	Length int
 }
 
 /**
  * get a mapi attribute
  * @param  {[type]} c *Data)        GetMapiAttribute(attrId int) (attr *MAPIAttribute [description]
  * @return {[type]}   [description]
+ *
+ * Deprecated: use GetString and the other getters, or Properties.
  */
 func (c *Data) GetMapiAttribute(attrId int) (attr *MAPIAttribute) {
-	if len(c.Attributes) > 0 {
-		for _, a := range c.Attributes {
-			if a.Name == attrId {
-				attr = &a
-				break
-			}
+	for i := range c.Attributes {
+		if c.Attributes[i].Name == attrId {
+			return &c.Attributes[i]
 		}
 	}
-	return
+	return nil
 }
 
 /**
@@ -167,13 +314,11 @@ func (c *Data) GetMapiAttribute(attrId int) (attr *MAPIAttribute) {
  */
 func (c *Data) AttachmentIsMimeRelated(a *Attachment) bool {
 
-	attContentIdAttr := a.GetMapiAttribute(MAPITagAttachContentId)
-	if attContentIdAttr == nil {
+	cid, ok := a.GetString(MAPITagAttachContentId)
+	if !ok {
 		return false
 	}
 
-	cid := attContentIdAttr.Data.(string)
-
 	if c.BodyHTML != nil && len(c.BodyHTML) > 0 && cid != "" {
 		re := `('|")[\s\t\r\n]*cid[\s\t\r\n]*\:[\s\t\r\n]*` + regexp.QuoteMeta(cid) + `[\s\t\r\n]*('|")`
 		matched, err := regexp.Match(re, c.BodyHTML)
@@ -185,18 +330,74 @@ func (c *Data) AttachmentIsMimeRelated(a *Attachment) bool {
 	return false
 }
 
-func (a *Attachment) addAttr(obj tnefObject) {
+// addAttr stores an attachment attribute; msg is the message it's in, which
+// has the code pages of the strings.
+func (a *Attachment) addAttr(obj tnefObject, l *limiter, msg *Data) error {
 	switch obj.Name {
 	case ATTATTACHTITLE:
 		s := strings.Replace(string(obj.Data), "\x00", "", -1)
 		if s != "" { // dont override with a blank string if set from the properties already
-			a.Title = strings.Replace(string(obj.Data), "\x00", "", -1)
+			a.Title = decodeString8(msg.OEMCodePage, s)
 		}
 	case ATTATTACHDATA:
 		a.Data = obj.Data
+	case ATTATTACHCREATEDATE:
+		if a.CreationTime.IsZero() { // the properties take precedence
+			a.CreationTime = decodeAttrDate(obj.Data)
+		}
+	case ATTATTACHMODIFYDATE:
+		if a.LastModificationTime.IsZero() {
+			a.LastModificationTime = decodeAttrDate(obj.Data)
+		}
+	case ATTATTACHMENT:
+		/*
+			MAPI ATTR ID: 3616 (0xe20), Type: 0x0003 -> PidTagAttachSize | value: 3285 (bytes)
+			MAPI ATTR ID: 12289 (0x3001), TAG Type: 30 (0x001e) -> PidTagDisplayName (type: 0x001f) | value: image001.jpg (same as PidTagAttachLongFilename)
+			MAPI ATTR ID: 14082 (0x3702), TAG Type: 258 (0x0102) -> PidTagAttachEncoding | value: empty!!?? ->  If the attachment is in MacBinary format, this property is set to
+				"{0x2A,86,48,86,F7,14,03,0B,01}"; otherwise, it is unset.
+			MAPI ATTR ID: 14083 (0x3703), TAG Type: 30 (0x001e) -> PidTagAttachExtension (type: 0x001e) | value: .jpg
+			MAPI ATTR ID: 14085 (0x3705), TAG Type: 3 (0x0003) -> PidTagAttachMethod | value: 1
+			MAPI ATTR ID: 14087 (0x3707), TAG Type: 30 (0x1e) -> PidTagAttachLongFilename (0x001F) | value: image001.jpg
+			MAPI ATTR ID: 14091 (0x370b), TAG Type: 3 (0x0003) -> PidTagRenderingPosition | value: -1 (-1 e de fapt 0xffffff, decoded as signed) ->  0xFFFFFFFF indicates a hidden attachment that is not to be rendered in the main text
+			MAPI ATTR ID: 14094 (0x370e), TAG Type: 30 (0x001e) -> PidTagAttachMimeTag | value: image/jpeg
+			MAPI ATTR ID: 14098 (0x3712), TAG Type: 30 (0x1e) -> PidTagAttachContentId | value: image001.jpg@01D49162.DB2DC760
+			MAPI ATTR ID: 14100 (0x3714), TAG Type: 3 (0x3) -> PidTagAttachFlags | value: 4 (4 means attRenderedInBody)
+			MAPI ATTR ID: 32762 (0x7ffa), TAG Type: 3 (0x3) -> PidTagAttachmentLinkId| value: 0 (must be 0, if is not overwriten)
+			MAPI ATTR ID: 32763 (0x7ffb), TAG Type: 64 (0x0040) ->	PidTagExceptionStartTime|value: 915151392000000000
+			MAPI ATTR ID: 32764 (0x7ffc), TAG Type: 64 (0x40) -> PidTagExceptionEndTime | value: 915151392000000000
+			MAPI ATTR ID: 32765 (0x7ffd), TAG Type: 3 (0x3) -> PidTagAttachmentFlags | value: 8
+			MAPI ATTR ID: 32766 (0x7ffe), TAG Type: 11 (0xb) -> PidTagAttachmentHidden| value: true
+			MAPI ATTR ID: 32767 (0x7fff), TAG Type: 11 (0xb) -> PidTagAttachmentContactPhoto | value: false
+			MAPI ATTR ID: 3617 (0x0e21), TAG Type: 3 (0x3) -> PidTagAttachNumber | value: 956325
+			MAPI ATTR ID: 4088 (0x0ff8), TAG Type: 258 (0x0102) -> PidTagMappingSignature | value: 28 78 81 160 198 126 89 69 167 247 18 51 167 63 155 237
+			MAPI ATTR ID: 4090 (0x0ffa), TAG Type: 258 (0x0102) -> ??? | value: 28 78 81 160 198 126 89 69 167 247 18 51 167 63 155 237
+			MAPI ATTR ID: 4094 (0xffe), TAG Type: 3 (0x3) -> PidTagObjectType | value: 7 (7 means Attachment object)
+			MAPI ATTR ID: 13325 (0x340d), TAG Type: 3 (0x3) -> PidTagStoreSupportMask | value: 245710845 ( Indicates whether string properties within the .msg file
+				are Unicode-encoded.)
+			MAPI ATTR ID: 13327 (0x340f), TAG Type: 3 (0x3) -> ??? | value: 245710845
+		*/
+
+		var err error
+		a.Properties, err = decodeMsgPropertyList(obj.Data, l)
+		if err != nil {
+			return obj.inAttribute(err)
+		}
+		a.Properties.decodeStrings(msg.CodePage())
+
+		// I've found attachments where the name is saved in the
+		// long file name and no title attribute, so account for that
+		a.setTitleFromPropsIfNeeded()
+		a.setDataFromProps()
+		if t, ok := a.GetTime(MAPICreationTime); ok {
+			a.CreationTime = t
+		}
+		if t, ok := a.GetTime(MAPILastModificationTime); ok {
+			a.LastModificationTime = t
+		}
 	default:
 		//fmt.Printf("ATT Flag: %x Value: %v\r\n\r\n", obj.Name, string(obj.Data))
 	}
+	return nil
 }
 
 // DecodeFile is a utility function that reads the file into memory
@@ -210,124 +411,302 @@ func DecodeFile(path string) (*Data, error) {
 	return Decode(data)
 }
 
+// DecodeOptions changes how TNEF data is decoded. The zero value uses the
+// defaults, which are the same as the package level Decode functions.
+type DecodeOptions struct {
+	// Limits restricts what the data can make the decoder allocate.
+	Limits Limits
+
+	// Strict makes an attribute with the wrong checksum an error, rather
+	// than a warning in Data.Warnings.
+	Strict bool
+
+	// Recover makes Decode skip the attributes it can't decode rather than
+	// return an error, so that everything else in a corrupt stream is still
+	// available. The errors are added to Data.Warnings and the skipped
+	// bytes to Data.Skipped. If an attribute runs past the end of the
+	// stream, decoding continues at the next attribute header after it.
+	// If the attAttachRendData that starts an attachment is skipped, so are
+	// the other attributes of the attachment.
+	//
+	// Exceeding one of the Limits is still an error.
+	//
+	// DecodeReader reads the entire stream into memory in recovery mode.
+	// The Decoder doesn't use this option.
+	Recover bool
+}
+
 // Decode will accept a stream of bytes in the TNEF format and extract the
 // attachments and body into a Data object.
 func Decode(data []byte) (*Data, error) {
-	if len(data) < 4 || byteToInt(data[0:4]) != tnefSignature {
+	return DecodeOptions{}.Decode(data)
+}
+
+// Decode is like the package level Decode, but uses the options in o.
+func (o DecodeOptions) Decode(data []byte) (*Data, error) {
+	return o.decode(data, newLimiter(o.Limits), 0)
+}
+
+// decode decodes a message at the given depth of embedded messages.
+func (o DecodeOptions) decode(data []byte, l *limiter, depth int) (*Data, error) {
+	if !hasSignature(data) {
 		return nil, ErrNoMarker
 	}
 
 	//key := binary.LittleEndian.Uint32(data[4:6])
 	offset := 6
-	var attachment *Attachment
+	if offset > len(data) {
+		offset = len(data)
+	}
 	tnef := &Data{
 		Attachments: []*Attachment{},
 	}
 
-	for {
+	// orphaned is set in recovery mode when an attAttachRendData is
+	// skipped; the attachment attributes after it are skipped as well,
+	// rather than added to the previous attachment.
+	orphaned := false
+	for offset < len(data) {
 		obj, ok := decodeTNEFObject(data[offset:])
 		if !ok {
-			break
+			if !o.Recover {
+				break
+			}
+			if len(data)-offset >= tnefObjectHeaderLength {
+				header, _ := decodeTNEFObjectHeader(data[offset:])
+				orphaned = orphaned || header.Name == ATTATTACHRENDDATA
+			}
+			next := resync(data, offset+1)
+			tnef.skip(offset, next-offset)
+			offset = next
+			continue
 		}
+		obj.Offset = offset
 		offset += obj.Length
 
-		if obj.Name == ATTOEMCODEPAGE {
-			//fmt.Printf("CODE PAGE: %s\r\n", bytes.TrimRight(obj.Data, "\x00"))
-		} else if obj.Name == ATTMESSAGECLASS {
-			tnef.MessageClass = bytes.TrimRight(obj.Data, "\x00")
-		} else if obj.Name == ATTATTACHRENDDATA {
-			/* Each set of attachment attributes MUST begin with the attAttachRendData attribute, followed by any
-			other attributes; attachment properties encoded in the attAttachment attribute SHOULD be last.
-
-			attAttachRendData = AttachType AttachPosition RenderWidth RenderHeight DataFlags
-			AttachType = AttachTypeFile / AttachTypeOle
-			AttachTypeFile=%x01.00
-			AttachTypeOle=%x02.00
-			AttachPosition= INT32
-			RenderWidth=INT16
-			RenderHeight=INT16
-			DataFlags = FileDataDefault / FileDataMacBinary
-			FileDataDefault= %x00.00.00.00
-			FileDataMacBinary=%x01.00.00.00
-			*/
-			attachment = new(Attachment)
-			tnef.Attachments = append(tnef.Attachments, attachment)
-
-		} else if obj.Level == lvlAttachment {
-			/*
-				AttachAttribute = attrLevelAttachment idAttachAttr Length Data Checksum
-				AttachProps = attrLevelAttachment idAttachment Length Data Checksum
-			*/
-
-			if obj.Name == ATTATTACHMENT {
-				/*
-					MAPI ATTR ID: 3616 (0xe20), Type: 0x0003 -> PidTagAttachSize | value: 3285 (bytes)
-					MAPI ATTR ID: 12289 (0x3001), TAG Type: 30 (0x001e) -> PidTagDisplayName (type: 0x001f) | value: image001.jpg (same as PidTagAttachLongFilename)
-					MAPI ATTR ID: 14082 (0x3702), TAG Type: 258 (0x0102) -> PidTagAttachEncoding | value: empty!!?? ->  If the attachment is in MacBinary format, this property is set to
-						"{0x2A,86,48,86,F7,14,03,0B,01}"; otherwise, it is unset.
-					MAPI ATTR ID: 14083 (0x3703), TAG Type: 30 (0x001e) -> PidTagAttachExtension (type: 0x001e) | value: .jpg
-					MAPI ATTR ID: 14085 (0x3705), TAG Type: 3 (0x0003) -> PidTagAttachMethod | value: 1
-					MAPI ATTR ID: 14087 (0x3707), TAG Type: 30 (0x1e) -> PidTagAttachLongFilename (0x001F) | value: image001.jpg
-					MAPI ATTR ID: 14091 (0x370b), TAG Type: 3 (0x0003) -> PidTagRenderingPosition | value: -1 (-1 e de fapt 0xffffff, decoded as signed) ->  0xFFFFFFFF indicates a hidden attachment that is not to be rendered in the main text
-					MAPI ATTR ID: 14094 (0x370e), TAG Type: 30 (0x001e) -> PidTagAttachMimeTag | value: image/jpeg
-					MAPI ATTR ID: 14098 (0x3712), TAG Type: 30 (0x1e) -> PidTagAttachContentId | value: image001.jpg@01D49162.DB2DC760
-					MAPI ATTR ID: 14100 (0x3714), TAG Type: 3 (0x3) -> PidTagAttachFlags | value: 4 (4 means attRenderedInBody)
-					MAPI ATTR ID: 32762 (0x7ffa), TAG Type: 3 (0x3) -> PidTagAttachmentLinkId| value: 0 (must be 0, if is not overwriten)
-					MAPI ATTR ID: 32763 (0x7ffb), TAG Type: 64 (0x0040) ->	PidTagExceptionStartTime|value: 915151392000000000
-					MAPI ATTR ID: 32764 (0x7ffc), TAG Type: 64 (0x40) -> PidTagExceptionEndTime | value: 915151392000000000
-					MAPI ATTR ID: 32765 (0x7ffd), TAG Type: 3 (0x3) -> PidTagAttachmentFlags | value: 8
-					MAPI ATTR ID: 32766 (0x7ffe), TAG Type: 11 (0xb) -> PidTagAttachmentHidden| value: true
-					MAPI ATTR ID: 32767 (0x7fff), TAG Type: 11 (0xb) -> PidTagAttachmentContactPhoto | value: false
-					MAPI ATTR ID: 3617 (0x0e21), TAG Type: 3 (0x3) -> PidTagAttachNumber | value: 956325
-					MAPI ATTR ID: 4088 (0x0ff8), TAG Type: 258 (0x0102) -> PidTagMappingSignature | value: 28 78 81 160 198 126 89 69 167 247 18 51 167 63 155 237
-					MAPI ATTR ID: 4090 (0x0ffa), TAG Type: 258 (0x0102) -> ??? | value: 28 78 81 160 198 126 89 69 167 247 18 51 167 63 155 237
-					MAPI ATTR ID: 4094 (0xffe), TAG Type: 3 (0x3) -> PidTagObjectType | value: 7 (7 means Attachment object)
-					MAPI ATTR ID: 13325 (0x340d), TAG Type: 3 (0x3) -> PidTagStoreSupportMask | value: 245710845 ( Indicates whether string properties within the .msg file
-						are Unicode-encoded.)
-					MAPI ATTR ID: 13327 (0x340f), TAG Type: 3 (0x3) -> ??? | value: 245710845
-				*/
-
-				var err error
-				attachment.Properties, err = decodeMsgPropertyList(obj.Data)
-				if err != nil {
-					return nil, err
-				}
-
-				// I've found attachments where the name is saved in the
-				// long file name and no title attribute, so account for that
-				attachment.setTitleFromPropsIfNeeded()
-
-				//fmt.Printf("%v / %x\r\n", obj.Name, obj.Name)
-				//fmt.Printf("%v", obj.Data)
-			} else {
-				attachment.addAttr(obj)
+		if orphaned && obj.Level == lvlAttachment && obj.Name != ATTATTACHRENDDATA {
+			tnef.skip(obj.Offset, obj.Length)
+			continue
+		}
+		err := tnef.verifyChecksum(obj, checksum(obj.Data), o.Strict)
+		if err == nil {
+			err = l.addAttribute(obj, len(obj.Data))
+		}
+		if err == nil {
+			err = tnef.addObject(obj, l)
+		}
+		if obj.Name == ATTATTACHRENDDATA {
+			orphaned = err != nil
+		}
+		if err != nil {
+			if !o.Recover || errors.Is(err, ErrLimitExceeded) {
+				return nil, err
 			}
+			tnef.Warnings = append(tnef.Warnings, err)
+			tnef.skip(obj.Offset, obj.Length)
+		}
+	}
 
-			//fmt.Printf("TNEF Attach Level Flag ID: %x Value: %v\r\n\r\n", obj.Name, string(obj.Data))
-		} else if obj.Name == ATTMAPIPROPS {
-			var err error
-			tnef.Attributes, err = decodeMapi(obj.Data)
-			if err != nil {
+	for _, a := range tnef.Attachments {
+		if err := a.decodeEmbedded(o, l, depth); err != nil {
+			if !o.Recover || errors.Is(err, ErrLimitExceeded) {
 				return nil, err
 			}
+			tnef.Warnings = append(tnef.Warnings, err)
+		}
+	}
 
-			// Get the body property if it's there
-			for _, attr := range tnef.Attributes {
-				switch attr.Name {
-				case MAPIBody:
-					tnef.Body = attr.Data
-				case MAPIBodyHTML:
-					tnef.BodyHTML = attr.Data
-				default:
-					//fmt.Printf("MAPI Flag: %x Value: %v\r\n\r\n", attr.Name, string(attr.Data))
+	return tnef, nil
+}
+
+// skip adds a range of the stream to Skipped, or extends the last range if
+// it's right before it.
+func (tnef *Data) skip(offset, length int) {
+	if n := len(tnef.Skipped); n > 0 {
+		if last := &tnef.Skipped[n-1]; last.Offset+last.Length == offset {
+			last.Length += length
+			return
+		}
+	}
+	tnef.Skipped = append(tnef.Skipped, ByteRange{Offset: offset, Length: length})
+}
+
+// hasSignature reports if data starts with the TNEF signature.
+func hasSignature(data []byte) bool {
+	return len(data) >= 4 && byteToInt(data[0:4]) == tnefSignature
+}
+
+// resync returns the offset of the first plausible TNEF object at or after
+// offset, or len(data) if there is none. An object is plausible if it's a
+// known attribute with the right level and type, fits in the data, and has
+// the right checksum.
+func resync(data []byte, offset int) int {
+	for ; offset < len(data); offset++ {
+		obj, ok := decodeTNEFObject(data[offset:])
+		if !ok {
+			continue
+		}
+		want, known := attributeTypes[obj.Name]
+		if known && want.level == obj.Level && want.typ == obj.Type && checksum(obj.Data) == obj.Checksum {
+			return offset
+		}
+	}
+	return len(data)
+}
+
+// attributeTypes are the level and type of the known attributes.
+var attributeTypes = map[int]struct{ level, typ int }{
+	ATTOWNER:                   {lvlMessage, atpByte},
+	ATTSENTFOR:                 {lvlMessage, atpByte},
+	ATTDELEGATE:                {lvlMessage, atpByte},
+	ATTDATESTART:               {lvlMessage, atpDate},
+	ATTDATEEND:                 {lvlMessage, atpDate},
+	ATTAIDOWNER:                {lvlMessage, atpLong},
+	ATTREQUESTRES:              {lvlMessage, atpShort},
+	ATTFROM:                    {lvlMessage, atpTriples},
+	ATTSUBJECT:                 {lvlMessage, atpString},
+	ATTDATESENT:                {lvlMessage, atpDate},
+	ATTDATERECD:                {lvlMessage, atpDate},
+	ATTMESSAGESTATUS:           {lvlMessage, atpByte},
+	ATTMESSAGECLASS:            {lvlMessage, atpWord},
+	ATTMESSAGEID:               {lvlMessage, atpString},
+	ATTPARENTID:                {lvlMessage, atpString},
+	ATTCONVERSATIONID:          {lvlMessage, atpString},
+	ATTBODY:                    {lvlMessage, atpText},
+	ATTPRIORITY:                {lvlMessage, atpShort},
+	ATTATTACHDATA:              {lvlAttachment, atpByte},
+	ATTATTACHTITLE:             {lvlAttachment, atpString},
+	ATTATTACHMETAFILE:          {lvlAttachment, atpByte},
+	ATTATTACHCREATEDATE:        {lvlAttachment, atpDate},
+	ATTATTACHMODIFYDATE:        {lvlAttachment, atpDate},
+	ATTDATEMODIFY:              {lvlMessage, atpDate},
+	ATTATTACHTRANSPORTFILENAME: {lvlAttachment, atpByte},
+	ATTATTACHRENDDATA:          {lvlAttachment, atpByte},
+	ATTMAPIPROPS:               {lvlMessage, atpByte},
+	ATTRECIPTABLE:              {lvlMessage, atpByte},
+	ATTATTACHMENT:              {lvlAttachment, atpByte},
+	ATTTNEFVERSION:             {lvlMessage, atpDword},
+	ATTOEMCODEPAGE:             {lvlMessage, atpByte},
+	ATTORIGNINALMESSAGECLASS:   {lvlMessage, atpWord},
+}
+
+// verifyChecksum checks that the checksum of an object matches sum, the
+// checksum of its data. A mismatch is an error in strict mode, and a warning
+// otherwise.
+func (tnef *Data) verifyChecksum(obj tnefObject, sum uint16, strict bool) error {
+	if sum == obj.Checksum {
+		return nil
+	}
+	err := &AttributeError{Offset: obj.Offset, Level: obj.Level, Name: obj.Name, Err: ErrChecksum}
+	if strict {
+		return err
+	}
+	tnef.Warnings = append(tnef.Warnings, err)
+	return nil
+}
+
+// addObject stores a single TNEF object in the Data. Attachment level objects
+// are added to the last attachment, which is started by attAttachRendData.
+func (tnef *Data) addObject(obj tnefObject, l *limiter) error {
+	var attachment *Attachment
+	if n := len(tnef.Attachments); n > 0 {
+		attachment = tnef.Attachments[n-1]
+	}
+
+	if obj.Name == ATTOEMCODEPAGE {
+		// attOemCodepage = PrimaryCodePage SecondaryCodePage
+		if len(obj.Data) >= 4 {
+			tnef.OEMCodePage = byteToInt(obj.Data[0:4])
+		}
+	} else if obj.Name == ATTMESSAGECLASS {
+		tnef.MessageClass = bytes.TrimRight(obj.Data, "\x00")
+	} else if obj.Name == ATTATTACHRENDDATA {
+		/* Each set of attachment attributes MUST begin with the attAttachRendData attribute, followed by any
+		other attributes; attachment properties encoded in the attAttachment attribute SHOULD be last.
+
+		attAttachRendData = AttachType AttachPosition RenderWidth RenderHeight DataFlags
+		AttachType = AttachTypeFile / AttachTypeOle
+		AttachTypeFile=%x01.00
+		AttachTypeOle=%x02.00
+		AttachPosition= INT32
+		RenderWidth=INT16
+		RenderHeight=INT16
+		DataFlags = FileDataDefault / FileDataMacBinary
+		FileDataDefault= %x00.00.00.00
+		FileDataMacBinary=%x01.00.00.00
+		*/
+		if err := l.addAttachment(); err != nil {
+			return obj.inAttribute(err)
+		}
+		tnef.Attachments = append(tnef.Attachments, new(Attachment))
+
+	} else if obj.Level == lvlAttachment {
+		/*
+			AttachAttribute = attrLevelAttachment idAttachAttr Length Data Checksum
+			AttachProps = attrLevelAttachment idAttachment Length Data Checksum
+		*/
+		if attachment == nil {
+			// Attachment attributes must follow an attAttachRendData.
+			return nil
+		}
+		return attachment.addAttr(obj, l, tnef)
+	} else if obj.Name == ATTRECIPTABLE {
+		var err error
+		tnef.Recipients, err = decodeRecipientTable(obj.Data, l, tnef.CodePage())
+		if err != nil {
+			return obj.inAttribute(err)
+		}
+	} else if obj.Name == ATTMAPIPROPS {
+		var err error
+		tnef.Properties, err = decodeMsgPropertyList(obj.Data, l)
+		if err != nil {
+			return obj.inAttribute(err)
+		}
+		cp := tnef.CodePage()
+		tnef.Properties.decodeStrings(cp)
+		tnef.Attributes = mapiAttributes(tnef.Properties)
+
+		tnef.ClientSubmitTime, _ = tnef.GetTime(MAPIClientSubmitTime)
+		tnef.MessageDeliveryTime, _ = tnef.GetTime(MAPIMessageDeliveryTime)
+		tnef.CreationTime, _ = tnef.GetTime(MAPICreationTime)
+		tnef.LastModificationTime, _ = tnef.GetTime(MAPILastModificationTime)
+
+		// Get the body property if it's there
+		for _, v := range tnef.Properties.Values {
+			switch v.TagId {
+			case MAPIBody:
+				tnef.Body = bodyValue(v, cp)
+			case MAPIBodyHTML:
+				tnef.BodyHTML = v.Raw
+			case MAPIRtfCompressed:
+				tnef.BodyRTF, err = decompressRTF(v.Raw, l.MaxRTFSize)
+				if err == nil {
+					err = l.addOutput(len(tnef.BodyRTF))
 				}
+				if err != nil {
+					return obj.inAttribute(&PropertyError{Tag: propTag(int(v.TagId), int(v.TagType)), Err: err})
+				}
+			}
+		}
+
+		// Outlook often only stores an RTF body, with the original HTML or
+		// plain text body encapsulated in it. An RTF body that can't be
+		// de-encapsulated isn't an error; it's still available in BodyRTF.
+		// The body is converted to UTF-8, from the message code page if
+		// the RTF doesn't have one.
+		if tnef.BodyRTF != nil {
+			body, html, err := deEncapsulateRTF(tnef.BodyRTF, cp)
+			if err == nil && html && len(tnef.BodyHTML) == 0 {
+				tnef.BodyHTML = body
+			} else if err == nil && !html && len(tnef.Body) == 0 {
+				tnef.Body = body
 			}
-		} else {
-			//fmt.Printf("TNEF Flag: %x Value: %s\r\n\r\n", obj.Name, obj.Data)
 		}
+	} else {
+		tnef.addMessageAttr(obj)
 	}
 
-	return tnef, nil
+	return nil
 }
 
 /**
@@ -335,25 +714,17 @@ func Decode(data []byte) (*Data, error) {
  * MessageProps = attrLevelMessage idMsgProps Length Data Checksum
  */
 func decodeTNEFObject(data []byte) (object tnefObject, ok bool) {
-	if len(data) < 9 {
+	if len(data) < tnefObjectHeaderLength {
 		return
 	}
-	offset := 0
-
-	object.Level = byteToInt(data[offset : offset+1])
-	offset++
-	object.Name = byteToInt(data[offset : offset+2])
-	offset += 2
-	object.Type = byteToInt(data[offset : offset+2])
-	offset += 2
-	attLength := byteToInt(data[offset : offset+4])
-	offset += 4
+	object, attLength := decodeTNEFObjectHeader(data)
+	offset := tnefObjectHeaderLength
 	if offset+attLength+2 > len(data) {
 		return
 	}
 	object.Data = data[offset : offset+attLength]
 	offset += attLength
-	//checksum := byteToInt(data[offset : offset+2])
+	object.Checksum = uint16(byteToInt(data[offset : offset+2]))
 	offset += 2
 
 	object.Length = offset
@@ -361,6 +732,25 @@ func decodeTNEFObject(data []byte) (object tnefObject, ok bool) {
 	return
 }
 
+// tnefObjectHeaderLength is the size of the level, name, type and length
+// fields that precede the data of every TNEF object.
+const tnefObjectHeaderLength = 9
+
+// decodeTNEFObjectHeader decodes the fixed size header of a TNEF object and
+// returns it together with the length of the data that follows it.
+func decodeTNEFObjectHeader(data []byte) (object tnefObject, attLength int) {
+	offset := 0
+
+	object.Level = byteToInt(data[offset : offset+1])
+	offset++
+	object.Name = byteToInt(data[offset : offset+2])
+	offset += 2
+	object.Type = byteToInt(data[offset : offset+2])
+	offset += 2
+	attLength = byteToInt(data[offset : offset+4])
+	return
+}
+
 /**
  *  MsgPropertyList = MsgPropertyCount *MsgPropertyValue
  *  MsgPropertyCount = UINT32
@@ -369,259 +759,150 @@ func decodeTNEFObject(data []byte) (object tnefObject, ok bool) {
  * @param  {[type]} data []byte)       (MsgPropertyList [description]
  * @return {[type]}      [description]
  */
-func decodeMsgPropertyList(data []byte) (MsgPropertyList, error) {
+func decodeMsgPropertyList(data []byte, l *limiter) (MsgPropertyList, error) {
+	list, _, err := decodeMsgProperties(data, l)
+	return list, err
+}
 
+// decodeMsgProperties decodes a MsgPropertyList from the start of data, and
+// returns the number of bytes it used. The recipient table has several of
+// these lists after each other.
+func decodeMsgProperties(data []byte, l *limiter) (MsgPropertyList, int, error) {
 	list := MsgPropertyList{Values: []*MsgPropertyValue{}}
 
 	// little endian reader
 	leReader := LittleEndianReader{}
-	/*
-		fmt.Println("------------------------")
-		fmt.Printf("\r\n\r\n%s\r\n\r\n",hex.Dump(data))
-		fmt.Printf("\r\n\r\n%s\r\n\r\n",data)
-		fmt.Println("------------------------")
-	*/
-	if len(data) < 4 {
-		return list, fmt.Errorf("decodeMsgPropertyList: data too short")
-	}
+	c := &leCursor{data: data, maxValues: l.MaxMultiValues}
 
 	//  MsgPropertyCount *MsgPropertyValue
-
-	offset := 0
-	// no of properties encoded
-	//	countValues := leReader.Uint32(data[offset:offset+4])
-
-	offset += 4
-
-	//fmt.Printf("Count values: %v\r\n", countValues)
+	// no of properties encoded; each one is at least 4 bytes
+	countValues := c.count(4)
+	if c.err {
+		return list, 0, &AttributeError{Offset: c.errOffset, Err: ErrTruncated}
+	}
+	if err := l.checkProperties(countValues); err != nil {
+		return list, 0, &AttributeError{Err: err}
+	}
 
 	//MsgPropertyValue = MsgPropertyTag MsgPropertyData
-
-	for {
-		v := MsgPropertyValue{}
+	for c.remaining() > 0 && len(list.Values) < countValues {
+		v := Property{}
 
 		//MsgPropertyTag = MsgPropertyType MsgPropertyId [NamedPropSpec]
-		v.TagType = leReader.Uint16(data[offset : offset+2]) // 2 bytes
-		//fmt.Printf("\r\nTAG Type: %#x Dump:\r\n%v", v.TagType, hex.Dump(data[offset:offset+2]))
-		offset += 2
-
+		v.TagType = c.uint16()
 		// tagId is MAPI Property
-		v.TagId = leReader.Uint16(data[offset : offset+2]) // 2 bytes
-		//fmt.Printf("\r\nTag ID: %#x Dump:\r\n%v", v.TagId, hex.Dump(data[offset:offset+2]))
-		offset += 2
+		v.TagId = c.uint16()
 
 		if v.TagId >= 0x8000 {
 			// has  NamedPropSpec; NamedPropSpec = PropNameSpace PropIDType PropMap
 
-			v.PropNameSpace = data[offset : offset+16] // guid - 16 bytes
-			offset += 16
-			v.PropIDType = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.PropNameSpace = decodeGUID(c.next(16))
+			v.PropIDType = c.uint32()
 			if v.PropIDType == 0x00000000 {
 				// should be an uint32 value
-				v.PropMap = data[offset : offset+4]
-				offset += 4
+				v.PropMap = c.next(4)
 			} else {
 				// propIDType == 0x01000000	=> is PropMap is string (PropMapString)
 				// PropMapString = UINT32 *UINT16 %x00.00 [PropMapPad]
-				valueLength := int(leReader.Uint32(data[offset : offset+4]))
-				offset += 4
-
-				tmpStr, bytesRead := leReader.Utf16(data[offset:], valueLength)
-				offset += bytesRead
-
+				valueLength := int(c.uint32())
+				tmpStr, _ := leReader.Utf16(c.next(valueLength), valueLength)
 				v.PropMap = []byte(tmpStr)
-
-				padd := 4 - bytesRead%4
-
-				if padd < 4 {
-					offset += padd
-				}
+				c.pad(valueLength)
 			}
 		}
 
 		v.DataCount = 1
-
-		//startValueIdx := offset
+		valueStart := c.offset
 
 		switch v.TagType {
 		case 0x0001: //NULL
 		case 0x0002: //Int16
 			v.DataType = "int16"
 			// int16  - 2 bytes + 2 padding
-			v.Data = leReader.Int16(data[offset : offset+2])
-			offset += 4
+			v.Data = int16(c.uint16())
+			c.pad(2)
 		case 0x1002: //TypeMVInt16
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.DataCount = uint32(c.values(2))
 			var tmp []int16
 			// extract the v.DataCount values of int16
 			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Int16(data[offset:offset+2]))
-				offset += 2
+				tmp = append(tmp, int16(c.uint16()))
 			}
-
 			// skip the padding if exists
-			if r := int(v.DataCount * 2 % 4); r != 0 {
-				offset += r
-			}
+			c.pad(int(v.DataCount) * 2)
 			v.Data = tmp
 			v.DataType = "int16"
-		case 0x0003: //TypeInt32
-			v.Data = leReader.Int32(data[offset : offset+4]) // has padd x00 at the end
-			offset += 4
+		case 0x0003, 0x000A: //TypeInt32, TypeErrorCode
+			v.Data = int32(c.uint32())
 			v.DataType = "int32"
 		case 0x1003: //TypeMVInt32
 			tmp := []int32{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.DataCount = uint32(c.values(4))
 			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Int32(data[offset:offset+4]))
-				offset += 4
+				tmp = append(tmp, int32(c.uint32()))
 			}
 			v.Data = tmp
 			v.DataType = "int32"
 		case 0x0004: //TypeFlt32
-			v.Data = leReader.Float32(data[offset : offset+4])
-			offset += 4
+			v.Data = math.Float32frombits(c.uint32())
 			v.DataType = "float32"
 		case 0x1004: //TypeMVFlt32
 			tmp := []float32{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.DataCount = uint32(c.values(4))
 			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Float32(data[offset:offset+4]))
-				offset += 4
+				tmp = append(tmp, math.Float32frombits(c.uint32()))
 			}
 			v.Data = tmp
 			v.DataType = "float32"
-		case 0x0005: //TypeFlt64
-			v.Data = leReader.Float64(data[offset : offset+8])
-			offset += 8
+		case 0x0005, 0x0007: //TypeFlt64, TypeAppTime
+			v.Data = math.Float64frombits(c.uint64())
 			v.DataType = "float64"
-		case 0x1005: //TypeMVFlt64
+		case 0x1005, 0x1007: //TypeMVFlt64, TypeMVAppTime
 			tmp := []float64{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.DataCount = uint32(c.values(8))
 			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Float64(data[offset:offset+8]))
-				offset += 8
+				tmp = append(tmp, math.Float64frombits(c.uint64()))
 			}
 			v.Data = tmp
 			v.DataType = "float64"
-		case 0x0006: //TypeCurrency  Signed 64-bit
-			v.Data = leReader.Int64(data[offset : offset+8]) // has padd x00 at the end
-			offset += 8
+		case 0x0006, 0x0014: //TypeCurrency  Signed 64-bit, TypeInt64
+			v.Data = int64(c.uint64())
 			v.DataType = "int64"
-		case 0x1006: //TypeMVCurrency  Signed 64-bit
+		case 0x1006, 0x1014: //TypeMVCurrency, TypeMVInt64
 			tmp := []int64{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
+			v.DataCount = uint32(c.values(8))
 			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Int64(data[offset:offset+8]))
-				offset += 8
+				tmp = append(tmp, int64(c.uint64()))
 			}
 			v.Data = tmp
 			v.DataType = "int64"
-		case 0x0007: //TypeAppTime
-			v.Data = leReader.Float64(data[offset : offset+8]) // has padd x00 at the end
-			offset += 8
-			v.DataType = "float64"
-		case 0x1007: //TypeMVAppTime
-			tmp := []float64{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
-			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Float64(data[offset:offset+8]))
-				offset += 8
-			}
-			v.Data = tmp
-			v.DataType = "float64"
 		case 0x000B: //TypeBoolean - 16 bits
-			v.Data = leReader.Int16(data[offset:offset+4]) > 0 // has padd x00 at the end
-			offset += 4
-		case 0x000D: //TypeObject -> unicode
-			noOfValues := leReader.Uint32(data[offset : offset+4]) // should be always 1
-			offset += 4
+			v.Data = int16(c.uint16()) > 0 // has padd x00 at the end
+			v.DataType = "bool"
+			c.pad(2)
+		case 0x000D: //TypeObject
+			noOfValues := c.values(4) // should be always 1
 			tmp := make([][]byte, noOfValues)
-			for i := 0; i < int(noOfValues); i++ {
-				bytesLength := int(leReader.Uint32(data[offset : offset+4]))
-
-				//fmt.Printf("String data length: %v Extracted Value: %v", stringLength, hex.Dump(data[offset:offset+4]))
-				offset += 4
-
-				/*
-					tmpRunes := []rune{}
-					for j:=0; j < int(stringLength); j++ {
-						r, size := utf8.DecodeRune(data[offset:])
-						tmpRunes = append(tmpRunes, r)
-						offset += size
-					}
-					tmp[i] = string(tmpRunes)
-				*/
-				tmp[i] = data[offset : offset+bytesLength]
-				offset += bytesLength
-
-				padd := 4 - bytesLength%4
-				if padd < 4 {
-					offset += padd
-				}
+			for i := range tmp {
+				bytesLength := int(c.uint32())
+				tmp[i] = c.next(bytesLength)
+				c.pad(bytesLength)
 			}
-
-			v.Data = tmp[0]
-			v.DataType = "object"
-		case 0x0014: //TypeInt64
-			v.Data = leReader.Int64(data[offset : offset+8]) // has padd x00 at the end
-			offset += 8
-			v.DataType = "int64"
-		case 0x1014: //TypeMVInt64
-			tmp := []int64{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
-			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.Int64(data[offset:offset+8]))
-				offset += 8
+			if len(tmp) > 0 {
+				v.Data = tmp[0]
+			} else {
+				v.Data = []byte{}
 			}
-			v.Data = tmp
-			v.DataType = "int64"
+			v.DataType = "object"
 		case 0x001E, 0x101E: //TypeString8, TypeMVString8 -  8-bit character string with terminating null character. - multibyte character set (MBCS):
 			// ATTOEMCODEPAGE???
-			noOfValues := leReader.Uint32(data[offset : offset+4]) // should be always 1
-			offset += 4
-
+			noOfValues := c.values(4) // should be always 1
 			tmp := make([]string, noOfValues)
-			for i := 0; i < int(noOfValues); i++ {
-				stringLength := int(leReader.Uint32(data[offset : offset+4]))
-
-				//fmt.Printf("String data length: %v Extracted Value: %v", stringLength, hex.Dump(data[offset:offset+4]))
-				offset += 4
-				/**
-				 * try to read stringLength chars and than calculate the number of bytes read
-				 */
-
-				tmpStr := data[offset : offset+stringLength]
-				offset += stringLength
-
-				//fmt.Println("String: ", string(tmpStr))
-				/*
-
-					rdr := bytes.NewReader(data[offset:])
-					tmpStr := []byte{}
-					for i:= 0; i< int(stringLength);i++ {
-						rune, runeBytesSize, err := rdr.ReadRune()
-						if err != nil {
-							// we should return an error too
-							return list, fmt.Errorf("decodeMsgPropertyList: error decoding %#x data type: %s", v.TagType, err)
-						}
-						tmpStr = append(tmpStr, []byte(string(rune))...)
-						offset += runeBytesSize
-					}
-				*/
+			for i := range tmp {
+				stringLength := int(c.uint32())
+				tmpStr := c.next(stringLength)
 				// reads a multiple of 4; the rest must be padd it with 0x00
-				padd := 4 - len(tmpStr)%4
-				if padd < 4 {
-					offset += padd
-				}
+				c.pad(stringLength)
 				tmp[i] = string(bytes.TrimRight(tmpStr, "\x00"))
 			}
 
@@ -637,31 +918,13 @@ func decodeMsgPropertyList(data []byte) (MsgPropertyList, error) {
 			v.DataType = "string"
 		case 0x001F, 0x101F:
 			//TypeUnicode (unicode utf16 LE string), TypeMVUnicode (array of unicode utf16 LE string)  - UTF-16LE or variant character string with terminating 2-byte null character.
-			noOfValues := leReader.Uint32(data[offset : offset+4])
-			offset += 4
-
+			noOfValues := c.values(4)
 			tmp := make([]string, noOfValues)
-			for i := 0; i < int(noOfValues); i++ {
-				stringLength := int(leReader.Uint32(data[offset : offset+4])) // no of bytes to read
-				//fmt.Printf("String data length: %v Extracted Value: %v", stringLength, hex.Dump(data[offset:offset+4]))
-				offset += 4
-
-				/**
-				 * try to read stringLength chars and than calculate the number of bytes read
-				 */
-
-				tmpStr, bytesRead := leReader.Utf16(data[offset:], stringLength)
-				offset += bytesRead
-
+			for i := range tmp {
+				stringLength := int(c.uint32()) // no of bytes to read
+				tmpStr, _ := leReader.Utf16(c.next(stringLength), stringLength)
 				// reads a multiple of 4; the rest must be padd it with 0x00
-				padd := 4 - (bytesRead % 4)
-				//fmt.Printf("\r\nString Length To Read: %v Runes: %v", stringLength, utf8.RuneCountInString(tmpStr))
-				//fmt.Printf("\r\nString bytes read: %v", bytesRead)
-				if padd < 4 {
-					offset += padd
-					//fmt.Printf("\r\nString padd added: %v",padd)
-				}
-
+				c.pad(stringLength)
 				tmp[i] = strings.TrimRight(tmpStr, "\x00")
 			}
 
@@ -676,50 +939,35 @@ func decodeMsgPropertyList(data []byte) (MsgPropertyList, error) {
 			}
 			v.DataType = "string"
 		case 0x0040: //TypeSystime - FILETIME (a PtypTime value, as specified in [MS-OXCDATA] section 2.11.1)
-			v.Data = leReader.Uint64(data[offset : offset+8])
-			offset += 8
+			v.Data = filetimeToTime(c.uint64())
+			v.DataType = "time"
 		case 0x1040: //TypeMVSystime
-			noOfValues := leReader.Uint32(data[offset : offset+4])
-			offset += 4
-			v.DataCount = noOfValues
-			tmp := make([]uint64, noOfValues)
-			for i := 0; i < int(noOfValues); i++ {
-				tmp[i] = leReader.Uint64(data[offset : offset+8])
-				offset += 8
+			v.DataCount = uint32(c.values(8))
+			tmp := make([]time.Time, v.DataCount)
+			for i := range tmp {
+				tmp[i] = filetimeToTime(c.uint64())
 			}
 			v.Data = tmp
+			v.DataType = "time"
 		case 0x0048: //TypeCLSID -  OLE GUID - 16 bytes
-			v.Data = leReader.String(data[offset : offset+16])
-			v.DataCount = 1
-			offset += 16
+			v.Data = decodeGUID(c.next(16))
+			v.DataType = "guid"
 		case 0x1048: //TypeMVCLSID
-			tmp := []string{}
-			v.DataCount = leReader.Uint32(data[offset : offset+4])
-			offset += 4
-			for i := 0; i < int(v.DataCount); i++ {
-				tmp = append(tmp, leReader.String(data[offset:offset+16]))
-				offset += 16
+			v.DataCount = uint32(c.values(16))
+			tmp := make([]GUID, v.DataCount)
+			for i := range tmp {
+				tmp[i] = decodeGUID(c.next(16))
 			}
 			v.Data = tmp
+			v.DataType = "guid"
 		case 0x0102, 0x1102: //TypeBinary, /TypeMVBinary
-			noOfValues := leReader.Uint32(data[offset : offset+4]) // should be always 1
-			offset += 4
-
+			noOfValues := c.values(4) // should be always 1
 			tmp := make([][]byte, noOfValues)
-
-			for i := 0; i < int(noOfValues); i++ {
-				binaryLength := leReader.Uint32(data[offset : offset+4])
-				//fmt.Printf("Binary data length: %v Extracted Value: %v", binaryLength, hex.Dump(data[offset:offset+4]))
-				offset += 4
-
-				tmp[i] = data[offset : offset+int(binaryLength)]
-				offset += int(binaryLength)
-
+			for i := range tmp {
+				binaryLength := int(c.uint32())
+				tmp[i] = c.next(binaryLength)
 				// reads a multiple of 4; the rest must be padd it with 0x00
-				padd := 4 - int(binaryLength)%4
-				if padd < 4 {
-					offset += padd
-				}
+				c.pad(binaryLength)
 			}
 
 			if v.TagType == 0x0102 {
@@ -733,17 +981,24 @@ func decodeMsgPropertyList(data []byte) (MsgPropertyList, error) {
 			}
 			v.DataType = "binary"
 		default:
-			return list, fmt.Errorf("decodeMsgPropertyList: data type %#x is invalid", v.TagType)
+			return list, c.offset, &PropertyError{
+				Offset: c.offset,
+				Tag:    propTag(int(v.TagId), int(v.TagType)),
+				Err:    ErrUnknownPropType,
+			}
 		}
 
-		//fmt.Printf("\r\n\r\nTTag ID : %#x\r\nTag Type: %#x,\r\nTag Data: %v\r\nExtracted value:\r\n%v\r\n", v.TagId, v.TagType, v.Data, hex.Dump(data[startValueIdx:offset]))
+		if c.err {
+			return list, c.offset, &PropertyError{
+				Offset: c.errOffset,
+				Tag:    propTag(int(v.TagId), int(v.TagType)),
+				Err:    c.cause(),
+			}
+		}
 
+		v.Raw = rawValue(v.TagType, data[valueStart:c.offset])
 		list.Values = append(list.Values, &v)
-
-		if offset >= len(data) {
-			break
-		}
 	}
 
-	return list, nil
+	return list, c.offset, nil
 }
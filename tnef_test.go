@@ -1,84 +1,85 @@
 package tnef
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestAttachments(t *testing.T) {
 	tests := []struct {
 		in              string
 		wantAttachments []string
+		wantRTF         bool
 		wantErr         string
 	}{
 		{"attachments", []string{
 			"ZAPPA_~2.JPG",
 			"bookmark.htm",
-		}, ""},
-		// will panic!
-		//{"panic", []string{
-		//	"ZAPPA_~2.JPG",
-		//	"bookmark.htm",
-		//}},
-		//{"MAPI_ATTACH_DATA_OBJ", []string{
-		//	"VIA_Nytt_1402.doc",
-		//	"VIA_Nytt_1402.pdf",
-		//	"VIA_Nytt_14021.htm",
-		//	"MAPI_ATTACH_DATA_OBJ-body.rtf",
-		//}},
-		//{"MAPI_OBJECT", []string{
-		//	"Untitled_Attachment",
-		//	"MAPI_OBJECT-body.rtf",
-		//}},
+		}, true, ""},
+		{"panic", []string{
+			"image001.jpg",
+			"image002.jpg",
+			"image003.png",
+		}, false, ""},
+		{"MAPI_ATTACH_DATA_OBJ", []string{
+			"VIA_Nytt_1402.doc",
+			"VIA_Nytt_1402.pdf",
+			"VIA_Nytt_14021.htm",
+		}, true, ""},
+		{"MAPI_OBJECT", []string{
+			"Untitled_Attachment",
+		}, true, ""},
 		//{"body", []string{
 		//	"body-body.html",
 		//}},
-		//{"data-before-name", []string{
-		//	"AUTOEXEC.BAT",
-		//	"CONFIG.SYS",
-		//	"boot.ini",
-		//	"data-before-name-body.rtf",
-		//}},
-		{"garbage-at-end", []string{}, ""},
-		//{"long-filename", []string{
-		//	"long-filename-body.rtf",
-		//}},
-		//{"missing-filenames", []string{
-		//	"missing-filenames-body.rtf",
-		//}},
-		{"multi-name-property", []string{}, ""},
+		{"data-before-name", []string{
+			"AUTOEXEC.BAT",
+			"CONFIG.SYS",
+			"boot.ini",
+		}, true, ""},
+		{"garbage-at-end", []string{}, false, ""},
+		{"long-filename", []string{
+			"ALLPRO~1.DAT",
+		}, true, ""},
+		{"missing-filenames", []string{
+			"generpts.src",
+			"TechlibDEC99.doc",
+			"TechlibDEC99-JAN00.doc",
+			"TechlibNOV99.doc",
+		}, true, ""},
+		{"multi-name-property", []string{}, false, ""},
 		//{"multi-value-attribute", []string{
 		//	"208225__5_seconds__Voice_Mail.mp3",
-		//	"multi-value-attribute-body.rtf",
-		//}},
+		//}, true, ""},
 		{"one-file", []string{
 			"AUTHORS",
-		}, ""},
-		//{"rtf", []string{
-		//	"rtf-body.rtf",
-		//}},
-		//{"triples", []string{
-		//	"triples-body.rtf",
-		//}},
+		}, false, ""},
+		{"rtf", []string{}, true, ""},
+		{"triples", []string{}, true, ""},
 		{"two-files", []string{
 			"AUTHORS",
 			"README",
-		}, ""},
+		}, false, ""},
 		{"unicode-mapi-attr-name", []string{
 			"spaconsole2.cfg",
 			"image001.png",
 			"image002.png",
 			"image003.png",
-		}, ""},
+		}, false, ""},
 		{"unicode-mapi-attr", []string{
 			"example.dat",
-		}, ""},
+		}, false, ""},
 
 		// Invalid files.
-		{"badchecksum", nil, ErrNoMarker.Error()},
-		{"empty-file", nil, ErrNoMarker.Error()},
+		{"badchecksum", nil, false, ErrNoMarker.Error()},
+		{"empty-file", nil, false, ErrNoMarker.Error()},
 	}
 
 	for _, tt := range tests {
@@ -96,6 +97,10 @@ func TestAttachments(t *testing.T) {
 					len(tt.wantAttachments), len(out.Attachments))
 			}
 
+			if tt.wantRTF != bytes.HasPrefix(out.BodyRTF, []byte(`{\rtf1`)) {
+				t.Errorf("wrong BodyRTF; want RTF: %v, got %q", tt.wantRTF, out.BodyRTF)
+			}
+
 			titles := []string{}
 			for _, a := range out.Attachments {
 				titles = append(titles, a.Title)
@@ -112,6 +117,648 @@ func TestAttachments(t *testing.T) {
 	}
 }
 
+func TestMessageAttributes(t *testing.T) {
+	out, err := Decode(read(t, "./testdata", "triples.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFrom := Address{
+		DisplayName:  "Martin Rakhmanoff",
+		AddressType:  "SMTP",
+		EmailAddress: "rakhmanoff@sundance.spb.ru",
+	}
+	if out.From != wantFrom {
+		t.Errorf("wrong From\ngot:  %#v\nwant: %#v", out.From, wantFrom)
+	}
+	if out.Subject != "Sample Summary" {
+		t.Errorf("wrong Subject: %q", out.Subject)
+	}
+	if want := time.Date(2003, 5, 23, 17, 26, 17, 0, time.UTC); !out.DateSent.Equal(want) {
+		t.Errorf("wrong DateSent: %v", out.DateSent)
+	}
+	if out.Priority != PriorityNormal {
+		t.Errorf("wrong Priority: %v", out.Priority)
+	}
+	if out.MessageStatus != MessageStatusRead|MessageStatusModified {
+		t.Errorf("wrong MessageStatus: %#x", out.MessageStatus)
+	}
+	if out.MessageID != "C326F5735704184D96EBD387444C618B" {
+		t.Errorf("wrong MessageID: %q", out.MessageID)
+	}
+	if string(out.Body) != "Sample description\r\n" {
+		t.Errorf("wrong Body: %q", out.Body)
+	}
+	if out.TNEFVersion != 0x00010000 {
+		t.Errorf("wrong TNEFVersion: %#x", out.TNEFVersion)
+	}
+}
+
+func TestDates(t *testing.T) {
+	ms := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04:05.999", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		file string
+		got  func(*Data) time.Time
+		want time.Time
+	}{
+		{"triples", func(d *Data) time.Time { return d.ClientSubmitTime }, ms("2003-05-23 13:26:17.7")},
+		{"triples", func(d *Data) time.Time { return d.MessageDeliveryTime }, ms("2003-05-23 13:26:17.685")},
+		{"triples", func(d *Data) time.Time { return d.CreationTime }, ms("2003-05-23 13:25:39.544")},
+		{"triples", func(d *Data) time.Time { return d.LastModificationTime }, ms("2003-05-23 13:26:36.778")},
+		{"one-file", func(d *Data) time.Time { return d.Attachments[0].CreationTime }, ms("1999-10-14 02:49:46.725")},
+		// From attAttachModifyDate, as there are no attachment properties.
+		{"data-before-name", func(d *Data) time.Time { return d.Attachments[0].LastModificationTime }, ms("2000-03-24 09:30:09")},
+		{"data-before-name", func(d *Data) time.Time { return d.Attachments[0].CreationTime }, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data := read(t, "./testdata", tt.file+".tnef")
+			out, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.got(out); !got.Equal(tt.want) {
+				t.Errorf("Decode: got %v; want %v", got, tt.want)
+			}
+
+			out, err = DecodeReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.got(out); !got.Equal(tt.want) {
+				t.Errorf("DecodeReader: got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	out, err := Decode(read(t, "./testdata", "body.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Recipients) != 1 {
+		t.Fatalf("wrong number of recipients: %d", len(out.Recipients))
+	}
+	r := out.Recipients[0]
+	if r.DisplayName != "3kuser2" || r.AddressType != "EX" || r.Type != RecipientTo {
+		t.Errorf("wrong recipient: %#v", r.Address)
+	}
+	if !strings.HasSuffix(r.EmailAddress, "/CN=RECIPIENTS/CN=3kuser2") {
+		t.Errorf("wrong EmailAddress: %q", r.EmailAddress)
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	tests := []string{
+		"attachments", "body", "data-before-name", "garbage-at-end",
+		"long-filename", "missing-filenames", "multi-name-property",
+		"multi-value-attribute", "one-file", "rtf", "triples", "two-files",
+		"unicode-mapi-attr-name", "unicode-mapi-attr", "MAPI_OBJECT",
+		"MAPI_ATTACH_DATA_OBJ", "empty-file", "panic",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			data := read(t, "./testdata", tt+".tnef")
+			want, wantErr := Decode(data)
+			out, err := DecodeReader(bytes.NewReader(data))
+			if err != wantErr {
+				t.Fatalf("wrong err\ngot:  %v\nwant: %v", err, wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !bytes.Equal(out.BodyHTML, want.BodyHTML) {
+				t.Errorf("BodyHTML differs from Decode")
+			}
+			if len(out.Attachments) != len(want.Attachments) {
+				t.Fatalf("wrong length; want %v, got %v",
+					len(want.Attachments), len(out.Attachments))
+			}
+			for i, a := range out.Attachments {
+				if a.Title != want.Attachments[i].Title {
+					t.Errorf("wrong title; want %q, got %q", want.Attachments[i].Title, a.Title)
+				}
+				if !bytes.Equal(a.Data, want.Attachments[i].Data) {
+					t.Errorf("data of %q differs from Decode", a.Title)
+				}
+			}
+		})
+	}
+}
+
+func TestNextAttachment(t *testing.T) {
+	tests := []string{
+		"attachments", "data-before-name", "missing-filenames",
+		"multi-value-attribute", "two-files", "unicode-mapi-attr-name",
+		"MAPI_ATTACH_DATA_OBJ", "panic",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			data := read(t, "./testdata", tt+".tnef")
+			want, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDecoder(bytes.NewReader(data))
+			i := 0
+			for d.NextAttachment() {
+				a := d.Attachment()
+				if i >= len(want.Attachments) {
+					t.Fatalf("too many attachments")
+				}
+				got, err := io.ReadAll(a.Open())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want.Attachments[i].Data) {
+					t.Errorf("data of %q differs from Decode", a.Title)
+				}
+				if a.Title != want.Attachments[i].Title {
+					t.Errorf("wrong title; want %q, got %q", want.Attachments[i].Title, a.Title)
+				}
+				if len(a.Properties.Values) != len(want.Attachments[i].Properties.Values) {
+					t.Errorf("wrong number of properties; want %d, got %d",
+						len(want.Attachments[i].Properties.Values), len(a.Properties.Values))
+				}
+				i++
+			}
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if i != len(want.Attachments) {
+				t.Errorf("wrong length; want %v, got %v", len(want.Attachments), i)
+			}
+			if !bytes.Equal(d.Message().MessageClass, want.MessageClass) {
+				t.Errorf("wrong message class; want %q, got %q", want.MessageClass, d.Message().MessageClass)
+			}
+		})
+	}
+
+	t.Run("skip data", func(t *testing.T) {
+		d := NewDecoder(bytes.NewReader(read(t, "./testdata", "two-files.tnef")))
+		titles := []string{}
+		for d.NextAttachment() {
+			titles = append(titles, d.Attachment().Title)
+		}
+		if err := d.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(titles, ",") != "AUTHORS,README" {
+			t.Errorf("wrong titles: %v", titles)
+		}
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	signature := []byte{0x78, 0x9f, 0x3e, 0x22, 0, 0}
+	stream := func(attrs ...[]byte) []byte {
+		return append(signature, bytes.Join(attrs, nil)...)
+	}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    AttributeError
+		wantTag uint32
+		wantErr error
+	}{
+		{
+			"attachment properties",
+			stream(
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0006, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHMENT, 0x0006, []byte{
+					1, 0, 0, 0, // count
+					0x1e, 0x00, 0x07, 0x37, // MAPIAttachLongFilename
+					1, 0, 0, 0, // 1 value
+					100, 0, 0, 0, // length
+					'a', 'b', 'c', 0,
+				}),
+			),
+			AttributeError{Offset: 56, Level: lvlAttachment, Name: ATTATTACHMENT}, 0x3707001e, ErrTruncated,
+		},
+		{
+			"message properties",
+			stream(tnefAttr(lvlMessage, ATTMAPIPROPS, 0x0006, []byte{
+				1, 0, 0, 0, // count
+				0x1e, 0x00, 0x37, 0x00, // MAPISubject
+			})),
+			AttributeError{Offset: 23, Level: lvlMessage, Name: ATTMAPIPROPS}, 0x0037001e, ErrTruncated,
+		},
+		{
+			"recipients",
+			stream(tnefAttr(lvlMessage, ATTRECIPTABLE, 0x0006, []byte{
+				1, 0, 0, 0, // rows
+				1, 0, 0, 0, // count
+				0x1e, 0x00, 0x01, 0x30, // MAPIDisplayName
+				1, 0, 0, 0, // 1 value
+				50, 0, 0, 0, // length
+			})),
+			AttributeError{Offset: 35, Level: lvlMessage, Name: ATTRECIPTABLE}, 0x3001001e, ErrTruncated,
+		},
+		{
+			"property count",
+			stream(
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0006, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHMENT, 0x0006, []byte{0xff, 0xff, 0xff, 0xff}),
+			),
+			AttributeError{Offset: 40, Level: lvlAttachment, Name: ATTATTACHMENT}, 0, ErrTruncated,
+		},
+		{
+			"unknown type",
+			stream(
+				tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0006, make([]byte, 14)),
+				tnefAttr(lvlAttachment, ATTATTACHMENT, 0x0006, []byte{
+					1, 0, 0, 0, // count
+					0x99, 0x00, 0x07, 0x37, // invalid type
+				}),
+			),
+			AttributeError{Offset: 48, Level: lvlAttachment, Name: ATTATTACHMENT}, 0x37070099, ErrUnknownPropType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoders := map[string]func() (*Data, error){
+				"Decode": func() (*Data, error) {
+					return Decode(tt.in)
+				},
+				"DecodeReader": func() (*Data, error) {
+					return DecodeReader(bytes.NewReader(tt.in))
+				},
+			}
+			for name, decode := range decoders {
+				_, err := decode()
+				var attrErr *AttributeError
+				if !errors.As(err, &attrErr) {
+					t.Fatalf("%s: wrong error: %#v", name, err)
+				}
+				if attrErr.Offset != tt.want.Offset || attrErr.Level != tt.want.Level || attrErr.Name != tt.want.Name {
+					t.Errorf("%s: wrong error\ngot:  %#v\nwant: %#v", name, attrErr, tt.want)
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s: wrong cause: %v", name, err)
+				}
+
+				var decErr *DecodeError
+				if !errors.As(err, &decErr) {
+					t.Fatalf("%s: no DecodeError: %v", name, err)
+				}
+				if decErr.Offset != tt.want.Offset || decErr.Attribute != tt.want.Name || decErr.Tag != tt.wantTag || decErr.Msg != tt.wantErr.Error() {
+					t.Errorf("%s: wrong DecodeError: %#v", name, decErr)
+				}
+
+				var propErr *PropertyError
+				if tt.wantTag == 0 {
+					if errors.As(err, &propErr) {
+						t.Errorf("%s: unexpected PropertyError: %v", name, err)
+					}
+					continue
+				}
+				if !errors.As(err, &propErr) {
+					t.Fatalf("%s: no PropertyError: %v", name, err)
+				}
+				if propErr.Tag != tt.wantTag || propErr.Offset != tt.want.Offset {
+					t.Errorf("%s: wrong PropertyError: %#v", name, propErr)
+				}
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	attachData := tnefAttr(lvlAttachment, ATTATTACHDATA, 0x0006, []byte("data"))
+	attachData[len(attachData)-1]++
+	data := bytes.Join([][]byte{
+		{0x78, 0x9f, 0x3e, 0x22, 0, 0},
+		tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0006, make([]byte, 14)),
+		attachData,
+		tnefAttr(lvlAttachment, ATTATTACHTITLE, 0x0001, []byte("a.txt\x00")),
+	}, nil)
+	want := AttributeError{Offset: 31, Level: lvlAttachment, Name: ATTATTACHDATA, Err: ErrChecksum}
+
+	decoders := map[string]func(DecodeOptions) (*Data, error){
+		"Decode": func(o DecodeOptions) (*Data, error) {
+			return o.Decode(data)
+		},
+		"DecodeReader": func(o DecodeOptions) (*Data, error) {
+			return o.DecodeReader(bytes.NewReader(data))
+		},
+		"NextAttachment": func(o DecodeOptions) (*Data, error) {
+			d := o.NewDecoder(bytes.NewReader(data))
+			for d.NextAttachment() {
+				if _, err := io.ReadAll(d.Attachment().Open()); err != nil {
+					return nil, err
+				}
+			}
+			return d.Message(), d.Err()
+		},
+	}
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			out, err := decode(DecodeOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out.Warnings) != 1 || *out.Warnings[0].(*AttributeError) != want {
+				t.Errorf("wrong warnings: %v", out.Warnings)
+			}
+
+			_, err = decode(DecodeOptions{Strict: true})
+			var attrErr *AttributeError
+			if !errors.As(err, &attrErr) || *attrErr != want {
+				t.Errorf("wrong error in strict mode: %#v", err)
+			}
+			if !errors.Is(err, ErrChecksum) {
+				t.Errorf("not ErrChecksum: %v", err)
+			}
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		// Corrupt the data of AUTHORS, the first attachment.
+		data := read(t, "./testdata", "two-files.tnef")
+		data[1807+tnefObjectHeaderLength]++
+		d := DecodeOptions{Strict: true}.NewDecoder(bytes.NewReader(data))
+		n := 0
+		for d.NextAttachment() {
+			n++
+			io.Copy(io.Discard, d.Attachment().Open())
+		}
+		if n != 1 {
+			t.Errorf("NextAttachment returned %d attachments after the error", n-1)
+		}
+		if !errors.Is(d.Err(), ErrChecksum) {
+			t.Errorf("wrong error: %v", d.Err())
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		files, err := filepath.Glob("./testdata/*.tnef")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			_, err := DecodeOptions{Strict: true}.Decode(read(t, f))
+			if err != nil && err != ErrNoMarker {
+				t.Errorf("%s: %v", f, err)
+			}
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	corrupt := read(t, "./testdata", "missing-filenames.tnef")
+	// Make the data of the second attachment run past the end of the stream.
+	copy(corrupt[67597+5:], []byte{0xff, 0xff, 0xff, 0x7f})
+
+	// Make the attAttachRendData of the second attachment run past the end
+	// of the stream.
+	corruptRendData := read(t, "./testdata", "missing-filenames.tnef")
+	copy(corruptRendData[67510+5:], []byte{0xff, 0xff, 0xff, 0x7f})
+
+	badProps := bytes.Join([][]byte{
+		{0x78, 0x9f, 0x3e, 0x22, 0, 0},
+		tnefAttr(lvlMessage, ATTMAPIPROPS, 0x0006, []byte{
+			1, 0, 0, 0, // count
+			0x1e, 0x00, 0x37, 0x00, // MAPISubject
+		}),
+		tnefAttr(lvlMessage, ATTSUBJECT, 0x0001, []byte("Subject\x00")),
+	}, nil)
+
+	tests := []struct {
+		name            string
+		in              []byte
+		wantSkipped     []ByteRange
+		wantWarnings    int
+		wantAttachments []string
+		wantSubject     string
+	}{
+		{
+			"garbage at end",
+			read(t, "./testdata", "garbage-at-end.tnef"),
+			[]ByteRange{{4183, 1}}, 0,
+			nil, "",
+		},
+		{
+			"attachment data",
+			corrupt,
+			[]ByteRange{{67597, 33803}}, 0,
+			[]string{"generpts.src", "TechlibDEC99.doc", "TechlibDEC99-JAN00.doc", "TechlibNOV99.doc"}, "Y2K problem with Add-DT",
+		},
+		{
+			"attachment start",
+			corruptRendData,
+			[]ByteRange{{67510, 34089}}, 0,
+			[]string{"generpts.src", "TechlibDEC99-JAN00.doc", "TechlibNOV99.doc"}, "Y2K problem with Add-DT",
+		},
+		{
+			"properties",
+			badProps,
+			[]ByteRange{{6, 19}}, 1,
+			nil, "Subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoders := map[string]func() (*Data, error){
+				"Decode": func() (*Data, error) {
+					return DecodeOptions{Recover: true}.Decode(tt.in)
+				},
+				"DecodeReader": func() (*Data, error) {
+					return DecodeOptions{Recover: true}.DecodeReader(bytes.NewReader(tt.in))
+				},
+			}
+			for name, decode := range decoders {
+				out, err := decode()
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if !reflect.DeepEqual(out.Skipped, tt.wantSkipped) {
+					t.Errorf("%s: wrong skipped ranges\ngot:  %v\nwant: %v", name, out.Skipped, tt.wantSkipped)
+				}
+				if len(out.Warnings) != tt.wantWarnings {
+					t.Errorf("%s: wrong warnings: %v", name, out.Warnings)
+				}
+				var titles []string
+				for _, a := range out.Attachments {
+					titles = append(titles, a.Title)
+				}
+				if !reflect.DeepEqual(titles, tt.wantAttachments) {
+					t.Errorf("%s: wrong attachments\ngot:  %q\nwant: %q", name, titles, tt.wantAttachments)
+				}
+				if out.Subject != tt.wantSubject {
+					t.Errorf("%s: wrong subject: %q", name, out.Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestProperties(t *testing.T) {
+	out, err := Decode(read(t, "./testdata", "unicode-mapi-attr-name.tnef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := out.Properties.get(MAPISubject)
+	if subject == nil {
+		t.Fatal("no MAPISubject property")
+	}
+	want := "RE: [ZGLOSZENIE] THU#29044 Aktualizacja numerów w dodatkowych panelach"
+	if subject.Data != want {
+		t.Errorf("wrong subject: %q", subject.Data)
+	}
+	if string(subject.Raw) != string(encodeUTF16(want)) {
+		t.Errorf("wrong raw subject: %q", subject.Raw)
+	}
+
+	attr := out.GetMapiAttribute(MAPISubject)
+	if attr == nil || attr.Type != szmapiUnicodeString || decodeUTF16(attr.Data) != want {
+		t.Errorf("wrong MAPIAttribute: %#v", attr)
+	}
+	if len(out.Attributes) != len(out.Properties.Values) {
+		t.Errorf("%d attributes for %d properties", len(out.Attributes), len(out.Properties.Values))
+	}
+
+	cid := out.Attachments[1].GetMapiAttribute(MAPITagAttachContentId)
+	if cid == nil || cid.Data != "image001.png@01CF8C82.F4A2A290" {
+		t.Errorf("wrong content id: %#v", cid)
+	}
+}
+
+func TestUtf16(t *testing.T) {
+	r := LittleEndianReader{}
+	tests := []struct {
+		in       string
+		max      int
+		want     string
+		wantRead int
+	}{
+		{"a\x00b\x00", 4, "ab", 4},
+		{"a\x00b\x00", 2, "a", 2},
+		{"a\x00b", 4, "a", 2},
+		{"", 4, "", 0},
+	}
+	for _, tt := range tests {
+		got, read := r.Utf16([]byte(tt.in), tt.max)
+		if got != tt.want || read != tt.wantRead {
+			t.Errorf("Utf16(%q, %d) = %q, %d; want %q, %d", tt.in, tt.max, got, read, tt.want, tt.wantRead)
+		}
+	}
+}
+
+func TestEmbeddedMessage(t *testing.T) {
+	inner := read(t, "./testdata", "one-file.tnef")
+	data := embedTNEF(inner)
+
+	out, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Attachments) != 1 {
+		t.Fatalf("wrong number of attachments: %d", len(out.Attachments))
+	}
+	msg := out.Attachments[0].EmbeddedMessage
+	if msg == nil {
+		t.Fatal("EmbeddedMessage is nil")
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Title != "AUTHORS" {
+		t.Errorf("wrong attachments in embedded message: %#v", msg.Attachments)
+	}
+
+	t.Run("reader", func(t *testing.T) {
+		out, err := DecodeReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Attachments) != 1 || out.Attachments[0].EmbeddedMessage == nil {
+			t.Errorf("embedded message not decoded: %#v", out.Attachments)
+		}
+
+		d := NewDecoder(bytes.NewReader(data))
+		if !d.NextAttachment() {
+			t.Fatalf("no attachment: %v", d.Err())
+		}
+		if d.Attachment().EmbeddedMessage == nil {
+			t.Error("embedded message not decoded by NextAttachment")
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		// Two levels of nesting.
+		data := embedTNEF(data)
+		tests := []struct {
+			depth   int
+			recover bool
+			want    int
+			wantErr error
+		}{
+			{0, false, 2, nil},
+			{-1, false, 0, nil},
+			{1, false, 0, ErrLimitExceeded},
+			{1, true, 0, ErrLimitExceeded},
+		}
+		for _, tt := range tests {
+			o := DecodeOptions{Limits: Limits{MaxEmbeddedDepth: tt.depth}, Recover: tt.recover}
+			out, err := o.Decode(data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MaxEmbeddedDepth %d: wrong error: %v", tt.depth, err)
+			}
+			if err != nil {
+				continue
+			}
+			got := 0
+			for msg := out; len(msg.Attachments) > 0 && msg.Attachments[0].EmbeddedMessage != nil; got++ {
+				msg = msg.Attachments[0].EmbeddedMessage
+			}
+			if got != tt.want {
+				t.Errorf("MaxEmbeddedDepth %d: decoded %d levels; want %d", tt.depth, got, tt.want)
+			}
+		}
+	})
+}
+
+// embedTNEF creates a TNEF stream with the TNEF stream inner as an
+// AttachEmbeddedMsg attachment.
+func embedTNEF(inner []byte) []byte {
+	obj := append(make([]byte, 16), inner...) // IID_IMessage isn't checked
+	props := []byte{
+		2, 0, 0, 0, // count
+		0x03, 0x00, 0x05, 0x37, 5, 0, 0, 0, // MAPIAttachMethod
+		0x0d, 0x00, 0x01, 0x37, 1, 0, 0, 0, // MAPIAttachDataObj, 1 value
+	}
+	props = append(props, le32(len(obj))...)
+	props = append(props, obj...)
+	props = append(props, make([]byte, -len(obj)&3)...)
+
+	data := []byte{0x78, 0x9f, 0x3e, 0x22, 0, 0}
+	data = append(data, tnefAttr(lvlAttachment, ATTATTACHRENDDATA, 0x0002, make([]byte, 14))...)
+	data = append(data, tnefAttr(lvlAttachment, ATTATTACHMENT, 0x0006, props)...)
+	return data
+}
+
+func tnefAttr(level, name, typ int, data []byte) []byte {
+	b := []byte{byte(level), byte(name), byte(name >> 8), byte(typ), byte(typ >> 8)}
+	b = append(b, le32(len(data))...)
+	b = append(b, data...)
+	return append(b, le16(int(checksum(data)))...)
+}
+
 func inStringSlice(list []string, str string) bool {
 	for _, item := range list {
 		if item == str {
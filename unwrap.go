@@ -0,0 +1,289 @@
+package tnef
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// UnwrapMIME reads an RFC 822 message from r and writes it to w with every
+// TNEF part (application/ms-tnef, or a file named winmail.dat) replaced by the
+// body and attachments it contains, as created by EncodeMIME. The rest of the
+// message, including the MIME structure around the TNEF parts, is written
+// unchanged. Forwarded messages (message/rfc822 parts) are unwrapped too.
+//
+// Parts that look like TNEF but don't start with the TNEF signature, or that
+// can't be decoded, are left alone.
+func UnwrapMIME(w io.Writer, r io.Reader) error {
+	msg, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	out, err := unwrapMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// unwrapMessage unwraps the TNEF parts in a message. If the message itself is
+// TNEF, its Content-* headers are replaced and the other headers kept.
+func unwrapMessage(msg []byte) ([]byte, error) {
+	rawHeader, body := splitEntity(msg)
+	header, err := parseHeader(rawHeader)
+	if err != nil {
+		// Not a message we can parse; leave it alone.
+		return msg, nil
+	}
+
+	if isTNEFEntity(header) {
+		e, ok, err := unwrapTNEF(header, body)
+		if err != nil || !ok {
+			return msg, err
+		}
+		var buf bytes.Buffer
+		buf.Write(filterHeader(rawHeader, func(name string) bool {
+			return !strings.HasPrefix(strings.ToLower(name), "content-")
+		}))
+		bw := bufio.NewWriter(&buf)
+		e.writeTo(bw)
+		bw.Flush()
+		return buf.Bytes(), nil
+	}
+
+	newBody, err := unwrapBody(header, body)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg[:len(rawHeader):len(rawHeader)], newBody...), nil
+}
+
+// unwrapPart unwraps a part of a multipart entity. A TNEF part is replaced
+// entirely, including its headers.
+func unwrapPart(part []byte) ([]byte, error) {
+	rawHeader, body := splitEntity(part)
+	header, err := parseHeader(rawHeader)
+	if err != nil {
+		return part, nil
+	}
+
+	if isTNEFEntity(header) {
+		e, ok, err := unwrapTNEF(header, body)
+		if err != nil || !ok {
+			return part, err
+		}
+		var buf bytes.Buffer
+		bw := bufio.NewWriter(&buf)
+		e.writeTo(bw)
+		bw.Flush()
+		return buf.Bytes(), nil
+	}
+
+	newBody, err := unwrapBody(header, body)
+	if err != nil {
+		return nil, err
+	}
+	return append(part[:len(rawHeader):len(rawHeader)], newBody...), nil
+}
+
+// unwrapBody unwraps the TNEF parts in the body of a multipart or
+// message/rfc822 entity; other bodies are returned unchanged.
+func unwrapBody(header textproto.MIMEHeader, body []byte) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return body, nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		return unwrapMultipart(body, params["boundary"])
+	case mediaType == "message/rfc822":
+		switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+		case "", "7bit", "8bit", "binary":
+			return unwrapMessage(body)
+		}
+	}
+	return body, nil
+}
+
+// unwrapMultipart unwraps the parts of a multipart body. Only the content of
+// the parts is changed; the preamble, delimiters and epilogue are kept as
+// they are.
+func unwrapMultipart(body []byte, boundary string) ([]byte, error) {
+	var out []byte
+	start := -1 // start of the current part, -1 in the preamble
+	for offset := 0; offset < len(body); {
+		line := body[offset:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+
+		closing, ok := isDelimiter(line, boundary)
+		if !ok {
+			offset += len(line)
+			continue
+		}
+
+		if start < 0 {
+			out = append(out, body[:offset]...)
+		} else {
+			// The line break before the delimiter belongs to it.
+			end := offset
+			if end > start && body[end-1] == '\n' {
+				end--
+				if end > start && body[end-1] == '\r' {
+					end--
+				}
+			}
+			part, err := unwrapPart(body[start:end])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, part...)
+			out = append(out, body[end:offset]...)
+		}
+		out = append(out, line...)
+		offset += len(line)
+		start = offset
+
+		if closing {
+			return append(out, body[offset:]...), nil
+		}
+	}
+
+	// No closing delimiter; keep the rest as it is.
+	if start < 0 {
+		return body, nil
+	}
+	return append(out, body[start:]...), nil
+}
+
+// isDelimiter reports if line is a delimiter line for the boundary, and if
+// it's the closing one.
+func isDelimiter(line []byte, boundary string) (closing, ok bool) {
+	prefix := "--" + boundary
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return false, false
+	}
+	rest := line[len(prefix):]
+	if bytes.HasPrefix(rest, []byte("--")) {
+		closing = true
+		rest = rest[2:]
+	}
+	return closing, len(bytes.TrimSpace(rest)) == 0
+}
+
+// unwrapTNEF decodes the TNEF data in an entity and converts it to MIME; ok
+// is false if it's not TNEF data after all, or if it can't be decoded.
+func unwrapTNEF(header textproto.MIMEHeader, body []byte) (e mimeEntity, ok bool, err error) {
+	data, err := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return e, false, nil
+	}
+	d, err := Decode(data)
+	if err != nil {
+		// A corrupt part is better than losing the whole message.
+		return e, false, nil
+	}
+	e, err = d.mimeBody()
+	return e, err == nil, err
+}
+
+// isTNEFEntity reports if an entity contains TNEF data, by its content type or
+// file name.
+func isTNEFEntity(header textproto.MIMEHeader) bool {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return true
+	}
+	_, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	return strings.EqualFold(params["name"], "winmail.dat") ||
+		strings.EqualFold(dispParams["filename"], "winmail.dat")
+}
+
+func decodeTransferEncoding(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, newlineSkipper{bytes.NewReader(body)}))
+	case "quoted-printable":
+		return ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	}
+	return body, nil
+}
+
+// newlineSkipper removes the line breaks and other white space from base64
+// data. The base64 decoder only skips \r and \n itself.
+type newlineSkipper struct {
+	r io.Reader
+}
+
+func (s newlineSkipper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, c := range p[:n] {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			p[j] = c
+			j++
+		}
+	}
+	return j, err
+}
+
+// splitEntity splits an entity in the header, including the empty line after
+// it, and the body.
+func splitEntity(data []byte) (header, body []byte) {
+	for offset := 0; offset < len(data); {
+		line := data[offset:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		offset += len(line)
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return data[:offset], data[offset:]
+		}
+	}
+	return data, nil
+}
+
+func parseHeader(raw []byte) (textproto.MIMEHeader, error) {
+	r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(raw), strings.NewReader("\r\n"))))
+	return r.ReadMIMEHeader()
+}
+
+// filterHeader returns the fields of a raw header for which keep returns true.
+// The empty line at the end of the header is not included.
+func filterHeader(raw []byte, keep func(name string) bool) []byte {
+	var out []byte
+	keeping := false
+	for offset := 0; offset < len(raw); {
+		line := raw[offset:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		offset += len(line)
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			break
+		}
+
+		// Lines starting with white space continue the previous field.
+		if line[0] != ' ' && line[0] != '\t' {
+			name := line
+			if i := bytes.IndexByte(line, ':'); i >= 0 {
+				name = line[:i]
+			}
+			keeping = keep(string(bytes.TrimSpace(name)))
+		}
+		if keeping {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
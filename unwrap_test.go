@@ -0,0 +1,154 @@
+package tnef
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapMIME(t *testing.T) {
+	tnef := base64.StdEncoding.EncodeToString(read(t, "./testdata", "two-files.tnef"))
+
+	tests := []struct {
+		name          string
+		in            string
+		wantStructure string
+		wantContains  []string
+	}{
+		{
+			"multipart",
+			"From: sender@example.com\r\n" +
+				"Subject: Test\r\n" +
+				"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+				"\r\n" +
+				"This is the preamble.\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"Hello\r\n" +
+				"--b1\r\n" +
+				"Content-Type: application/ms-tnef; name=\"winmail.dat\"\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				tnef + "\r\n" +
+				"--b1--\r\n" +
+				"The epilogue.\r\n",
+			"multipart/mixed[text/plain multipart/mixed[text/plain application/octet-stream application/octet-stream]]",
+			[]string{
+				"Subject: Test\r\n",
+				"\r\nThis is the preamble.\r\n--b1\r\nContent-Type: text/plain\r\n\r\nHello\r\n--b1\r\n",
+				"filename=AUTHORS",
+				"filename=README",
+				"--b1--\r\nThe epilogue.\r\n",
+			},
+		},
+		{
+			"message",
+			"From: sender@example.com\r\n" +
+				"Content-Type: application/octet-stream;\r\n" +
+				"\tname=\"WINMAIL.DAT\"\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"Subject: Test\r\n" +
+				"\r\n" +
+				tnef,
+			"multipart/mixed[text/plain application/octet-stream application/octet-stream]",
+			[]string{"From: sender@example.com\r\nSubject: Test\r\n"},
+		},
+		{
+			"forwarded",
+			"Content-Type: multipart/mixed; boundary=b1\r\n" +
+				"\r\n" +
+				"--b1\r\n" +
+				"Content-Type: message/rfc822\r\n" +
+				"\r\n" +
+				"Subject: Forwarded\r\n" +
+				"Content-Type: application/ms-tnef\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				tnef + "\r\n" +
+				"--b1--\r\n",
+			"multipart/mixed[message/rfc822]",
+			[]string{"Subject: Forwarded\r\nContent-Type: multipart/mixed", "filename=README"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := UnwrapMIME(&buf, strings.NewReader(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+
+			for _, want := range tt.wantContains {
+				if !strings.Contains(out, want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out)
+				}
+			}
+
+			msg, err := mail.ReadMessage(strings.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := mimeStructure(t, msg.Header, msg.Body, map[string]string{})
+			if got != tt.wantStructure {
+				t.Errorf("wrong structure\ngot:  %s\nwant: %s", got, tt.wantStructure)
+			}
+		})
+	}
+}
+
+func TestUnwrapMIMEUnchanged(t *testing.T) {
+	tests := []string{
+		"Subject: No MIME\n\nJust text.\n",
+		"Content-Type: multipart/alternative; boundary=b1\n" +
+			"\n" +
+			"--b1\n" +
+			"Content-Type: text/plain\n" +
+			"\n" +
+			"Text\n" +
+			"--b1\n" +
+			"Content-Type: text/html\n" +
+			"\n" +
+			"<p>HTML</p>\n" +
+			"--b1--\n",
+		// Named winmail.dat, but not TNEF.
+		"Content-Type: multipart/mixed; boundary=b1\r\n" +
+			"\r\n" +
+			"--b1\r\n" +
+			"Content-Disposition: attachment; filename=winmail.dat\r\n" +
+			"\r\n" +
+			"not TNEF\r\n" +
+			"--b1--\r\n",
+		// No closing delimiter.
+		"Content-Type: multipart/mixed; boundary=b1\r\n\r\n--b1\r\n\r\ntext",
+	}
+
+	// A TNEF part with a property of an unknown type.
+	corrupt := append([]byte{0x78, 0x9f, 0x3e, 0x22, 0, 0}, tnefAttr(lvlMessage, ATTMAPIPROPS, atpByte,
+		append(le32(1), le32(MAPISubject<<16|0x0099)...))...)
+	tests = append(tests, "Content-Type: multipart/mixed; boundary=b1\r\n"+
+		"\r\n"+
+		"--b1\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"Text\r\n"+
+		"--b1\r\n"+
+		"Content-Type: application/ms-tnef\r\n"+
+		"Content-Transfer-Encoding: base64\r\n"+
+		"\r\n"+
+		base64.StdEncoding.EncodeToString(corrupt)+"\r\n"+
+		"--b1--\r\n")
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := UnwrapMIME(&buf, strings.NewReader(tt)); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt {
+			t.Errorf("message was changed\ngot:  %q\nwant: %q", buf.String(), tt)
+		}
+	}
+}
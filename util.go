@@ -3,6 +3,7 @@ package tnef
 import (
 	"bytes"
 	"encoding/binary"
+	"time"
 	"unicode/utf16"
 	// "unicode/utf8"
 	// "strings"
@@ -131,41 +132,136 @@ func (c *LittleEndianReader) Boolean(b []byte) bool {
 	return v
 }
 
-// read utf16 little endian
+// read utf16 little endian, up to maxBytesToRead bytes. Reading stops at the
+// end of content, so bytesRead tells if the string was truncated.
 func (c *LittleEndianReader) Utf16(content []byte, maxBytesToRead int) (convertedStringToUnicode string, bytesRead int) {
 	tmp := []uint16{}
-
-	bytesRead = 0
-	//last2Chars := 0
-	for {
+	for bytesRead+2 <= len(content) && bytesRead < maxBytesToRead {
 		tmp = append(tmp, binary.LittleEndian.Uint16(content[bytesRead:]))
 		bytesRead += 2
+	}
+	return string(utf16.Decode(tmp)), bytesRead
+}
 
-		convertedStringToUnicode = string(utf16.Decode(tmp))
-
-		/*
-			if strings.HasSuffix(convertedStringToUnicode, "\x00") {
-				last2Chars++
-			} else {
-				last2Chars = 0
-			}
-		*/
+// decodeUTF16 decodes a UTF-16LE string, up to the first null character.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
 
-		// utf8.RuneCountInString(convertedStringToUnicode) -> number of chars
-		// len(convertedStringToUnicode) - number of bytes
+// leCursor reads little endian values from data with bounds checks. A read
+// past the end returns zero values and records the offset in errOffset, so
+// the decoders only need to check err once per value; cause tells why.
+type leCursor struct {
+	data      []byte
+	offset    int
+	err       bool
+	errOffset int
 
-		//		fmt.Printf("\r\nRead %v bytes from %v bytes; String Len: %v; Rune Count: %v", bytesRead, len(content), len(convertedStringToUnicode), utf8.RuneCountInString(convertedStringToUnicode))
-		//		fmt.Printf("\r\nString: %s", convertedStringToUnicode)
+	maxValues int  // limit for values, if not zero
+	exceeded  bool // err is set because maxValues was exceeded
+}
 
-		if len(content) <= bytesRead || bytesRead >= maxBytesToRead {
-			/*
-				if (last2Chars >= 2) {
-					convertedStringToUnicode = strings.TrimRight(convertedStringToUnicode, "\x00")
-				}*/
-			//fmt.Printf("\r\n Return Read: %v", bytesRead)
-			break
+// next returns the next n bytes, or nil if there aren't enough.
+func (c *leCursor) next(n int) []byte {
+	if c.err || n < 0 || n > len(c.data)-c.offset {
+		if !c.err {
+			c.err = true
+			c.errOffset = c.offset
 		}
-		//fmt.Printf("\r\n  Read: %v from maxLengthToRead %v len: %v str: %v", bytesRead, maxBytesToRead, len(convertedStringToUnicode), convertedStringToUnicode)
+		return nil
+	}
+	b := c.data[c.offset : c.offset+n]
+	c.offset += n
+	return b
+}
+
+func (c *leCursor) uint16() uint16 {
+	if b := c.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (c *leCursor) uint32() uint32 {
+	if b := c.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (c *leCursor) uint64() uint64 {
+	if b := c.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
 	}
-	return
+	return 0
+}
+
+// count reads a count of values that are at least size bytes each, and
+// checks that they fit in the remaining data.
+func (c *leCursor) count(size int) int {
+	start := c.offset
+	n := int(c.uint32())
+	if !c.err && n > (len(c.data)-c.offset)/size {
+		c.err = true
+		c.errOffset = start
+		return 0
+	}
+	return n
+}
+
+// values reads the number of values of a multi-valued property, like count,
+// and checks it against maxValues.
+func (c *leCursor) values(size int) int {
+	start := c.offset
+	n := c.count(size)
+	if !c.err && c.maxValues != 0 && n > c.maxValues {
+		c.err, c.exceeded = true, true
+		c.errOffset = start
+		return 0
+	}
+	return n
+}
+
+// cause returns the error for a failed read.
+func (c *leCursor) cause() error {
+	if c.exceeded {
+		return limitError("values", c.maxValues)
+	}
+	return ErrTruncated
+}
+
+// pad skips the padding after a value of n bytes up to a multiple of 4 bytes.
+// Missing padding at the end of the data is ignored.
+func (c *leCursor) pad(n int) {
+	c.offset += -n & 3
+	if c.offset > len(c.data) {
+		c.offset = len(c.data)
+	}
+}
+
+func (c *leCursor) remaining() int {
+	return len(c.data) - c.offset
+}
+
+// filetimeEpoch is the number of seconds between the start of the FILETIME
+// epoch, January 1, 1601, and the Unix epoch.
+const filetimeEpoch = 11644473600
+
+// filetimeToTime converts a FILETIME, the number of 100 nanosecond intervals
+// since January 1, 1601 UTC, to a time.Time.
+func filetimeToTime(ft uint64) time.Time {
+	return time.Unix(int64(ft/1e7)-filetimeEpoch, int64(ft%1e7)*100).UTC()
+}
+
+// timeToFiletime converts t to a FILETIME.
+func timeToFiletime(t time.Time) uint64 {
+	return uint64((t.Unix()+filetimeEpoch)*1e7 + int64(t.Nanosecond()/100))
 }
@@ -0,0 +1,221 @@
+package tnef
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNotContact is returned by EncodeVCard for messages that aren't contacts.
+var ErrNotContact = errors.New("tnef: not a contact")
+
+// vcardPhones are the telephone number properties of a contact, and their TEL
+// types.
+var vcardPhones = []struct {
+	tag   int
+	types string
+}{
+	{MAPIPrimaryTelephoneNumber, "voice"},
+	{MAPIBusinessTelephoneNumber, "work,voice"},
+	{MAPIBusiness2TelephoneNumber, "work,voice"},
+	{MAPICompanyMainPhoneNumber, "work,voice"},
+	{MAPIHomeTelephoneNumber, "home,voice"},
+	{MAPIHome2TelephoneNumber, "home,voice"},
+	{MAPIMobileTelephoneNumber, "cell"},
+	{MAPICarTelephoneNumber, "voice"},
+	{MAPIOtherTelephoneNumber, "voice"},
+	{MAPIBusinessFaxNumber, "work,fax"},
+	{MAPIHomeFaxNumber, "home,fax"},
+	{MAPIPrimaryFaxNumber, "fax"},
+	{MAPIPagerTelephoneNumber, "pager"},
+	{MAPITtytddPhoneNumber, "textphone"},
+}
+
+// vcardAddress is an address of a contact; the properties of the post office
+// box, street, city, state, postal code and country.
+type vcardAddress struct {
+	typ   string
+	id    int32          // the value of PidLidPostalAddressId for the mailing address
+	props [6]interface{} // MAPI tags (int) or named property names (string)
+}
+
+var vcardAddresses = []vcardAddress{
+	{"home", 1, [6]interface{}{
+		MAPIHomeAddressPostOfficeBox, MAPIHomeAddressStreet, MAPIHomeAddressCity,
+		MAPIHomeAddressStateOrProvince, MAPIHomeAddressPostalCode, MAPIHomeAddressCountry,
+	}},
+	{"work", 2, [6]interface{}{
+		"PidLidWorkAddressPostOfficeBox", "PidLidWorkAddressStreet", "PidLidWorkAddressCity",
+		"PidLidWorkAddressState", "PidLidWorkAddressPostalCode", "PidLidWorkAddressCountry",
+	}},
+	{"", 3, [6]interface{}{
+		MAPIOtherAddressPostOfficeBox, MAPIOtherAddressStreet, MAPIOtherAddressCity,
+		MAPIOtherAddressStateOrProvince, MAPIOtherAddressPostalCode, MAPIOtherAddressCountry,
+	}},
+}
+
+// EncodeVCard writes a contact to w as an RFC 6350 vCard 4.0, for address
+// books that don't understand TNEF. It returns ErrNotContact for other
+// messages.
+//
+// The names, company, phone numbers, addresses and dates come from the
+// contact properties, and the e-mail addresses from the PSETID_Address named
+// properties; only SMTP addresses are included. The attachment with
+// PR_ATTACHMENT_CONTACTPHOTO set is the PHOTO.
+func EncodeVCard(w io.Writer, d *Data) error {
+	class := string(d.MessageClass)
+	if s, ok := d.GetString(MAPIMessageClass); ok && class == "" {
+		class = s
+	}
+	if !strings.EqualFold(class, "IPM.Contact") && !hasPrefixFold(class, "IPM.Contact.") {
+		return ErrNotContact
+	}
+	str := func(tag int) string {
+		s, _ := d.GetString(tag)
+		return strings.TrimSpace(s)
+	}
+
+	vc := icalWriter{w: bufio.NewWriter(w)} // vCard has the same content lines
+	vc.line("BEGIN", "VCARD")
+	vc.line("VERSION", "4.0")
+	vc.line("PRODID", "-//teamwork//tnef//EN")
+
+	fn := str(MAPIDisplayName)
+	if fn == "" {
+		fn = strings.TrimSpace(d.subject())
+	}
+	if fn == "" {
+		fn, _ = d.namedString("PidLidFileUnder")
+	}
+	vc.line("FN", icalText(fn))
+	n := []string{str(MAPISurname), str(MAPIGivenName), str(MAPIMiddleName), str(MAPIDisplayNamePrefix), str(MAPIGeneration)}
+	if strings.Join(n, "") != "" {
+		vc.line("N", vcardJoin(n, ";"))
+	}
+	if s := str(MAPINickname); s != "" {
+		vc.line("NICKNAME", icalText(s))
+	}
+	switch g, _ := d.GetInt32(MAPIGender); g {
+	case 1:
+		vc.line("GENDER", "F")
+	case 2:
+		vc.line("GENDER", "M")
+	}
+	if t, ok := d.GetTime(MAPIBirthday); ok && !t.IsZero() {
+		vc.line("BDAY", nearestDate(t))
+	}
+	if t, ok := d.GetTime(MAPIWeddingAnniversary); ok && !t.IsZero() {
+		vc.line("ANNIVERSARY", nearestDate(t))
+	}
+
+	for i := 1; i <= 3; i++ {
+		prefix := "PidLidEmail" + strconv.Itoa(i)
+		typ, _ := d.namedString(prefix + "AddressType")
+		email, _ := d.namedString(prefix + "EmailAddress")
+		if addr := mailAddress(Address{AddressType: typ, EmailAddress: email}, ""); addr != nil {
+			vc.line("EMAIL;PREF="+strconv.Itoa(i), addr.Address)
+		}
+	}
+	for _, p := range vcardPhones {
+		if s := str(p.tag); s != "" {
+			vc.line("TEL;TYPE="+p.types, icalText(s))
+		}
+	}
+	if s, _ := d.namedString("PidLidInstantMessagingAddress"); s != "" {
+		vc.line("IMPP", s)
+	}
+
+	mailing, _ := d.namedInt32("PidLidPostalAddressId")
+	for _, a := range vcardAddresses {
+		var values []string
+		for _, p := range a.props {
+			var s string
+			switch p := p.(type) {
+			case int:
+				s = str(p)
+			case string:
+				s, _ = d.namedString(p)
+			}
+			values = append(values, strings.TrimSpace(s))
+		}
+		if strings.Join(values, "") == "" {
+			continue
+		}
+		name := "ADR"
+		if a.typ != "" {
+			name += ";TYPE=" + a.typ
+		}
+		if a.id == mailing {
+			name += ";PREF=1"
+		}
+		// The second component, the extended address, is empty.
+		vc.line(name, vcardJoin(append([]string{values[0], ""}, values[1:]...), ";"))
+	}
+
+	if org := []string{str(MAPICompanyName), str(MAPIDepartmentName)}; org[0] != "" || org[1] != "" {
+		if org[1] == "" {
+			org = org[:1]
+		}
+		vc.line("ORG", vcardJoin(org, ";"))
+	}
+	if s := str(MAPITitle); s != "" {
+		vc.line("TITLE", icalText(s))
+	}
+	if s := str(MAPIProfession); s != "" {
+		vc.line("ROLE", icalText(s))
+	}
+	if s := str(MAPIBusinessHomePage); s != "" {
+		vc.line("URL;TYPE=work", s)
+	}
+	if s := str(MAPIPersonalHomePage); s != "" {
+		vc.line("URL;TYPE=home", s)
+	}
+	if keywords := d.GetNamed("Keywords"); keywords != nil {
+		if list, ok := keywords.Data.([]string); ok && len(list) > 0 {
+			vc.line("CATEGORIES", vcardJoin(list, ","))
+		}
+	}
+	if text := strings.TrimSpace(string(d.textBody())); text != "" {
+		vc.line("NOTE", icalText(text))
+	}
+	for _, a := range d.Attachments {
+		if photo, _ := a.GetBool(MAPITagAttachmentContactPhoto); photo && len(a.Data) > 0 {
+			vc.line("PHOTO", "data:"+photoType(a)+";base64,"+base64.StdEncoding.EncodeToString(a.Data))
+			break
+		}
+	}
+	if !d.LastModificationTime.IsZero() {
+		vc.line("REV", icalTime(d.LastModificationTime))
+	}
+
+	vc.line("END", "VCARD")
+	return vc.w.Flush()
+}
+
+// vcardJoin escapes and joins the components of a structured value, like N
+// or ADR, with ";", or the values of a multi-valued property with ",".
+func vcardJoin(values []string, sep string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = icalText(v)
+	}
+	return strings.Join(escaped, sep)
+}
+
+// photoType returns the media type of a contact photo; Outlook stores them as
+// ContactPicture.jpg.
+func photoType(a *Attachment) string {
+	t := a.Properties.getString(MAPIAttachMimeTag)
+	if t == "" {
+		t = mime.TypeByExtension(path.Ext(a.Title))
+	}
+	if media, _, err := mime.ParseMediaType(t); err == nil && strings.HasPrefix(media, "image/") {
+		return media
+	}
+	return "image/jpeg"
+}
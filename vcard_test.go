@@ -0,0 +1,107 @@
+package tnef
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeVCard(t *testing.T) {
+	props := []*Property{
+		{TagType: szmapiUnicodeString, TagId: MAPIDisplayName, Data: "Jane Doe"},
+		{TagType: szmapiUnicodeString, TagId: MAPIGivenName, Data: "Jane"},
+		{TagType: szmapiUnicodeString, TagId: MAPISurname, Data: "Doe"},
+		{TagType: szmapiUnicodeString, TagId: MAPIDisplayNamePrefix, Data: "Dr."},
+		{TagType: szmapiUnicodeString, TagId: MAPICompanyName, Data: "Example, Inc."},
+		{TagType: szmapiUnicodeString, TagId: MAPITitle, Data: "Head of Research"},
+		{TagType: szmapiUnicodeString, TagId: MAPIBusinessTelephoneNumber, Data: "+1 555 0100"},
+		{TagType: szmapiUnicodeString, TagId: MAPIMobileTelephoneNumber, Data: "+1 555 0199"},
+		{TagType: szmapiUnicodeString, TagId: MAPIHomeAddressStreet, Data: "1 Home Road"},
+		{TagType: szmapiUnicodeString, TagId: MAPIHomeAddressCity, Data: "Springfield"},
+		{TagType: szmapiUnicodeString, TagId: MAPIBusinessHomePage, Data: "https://example.com"},
+		{TagType: szmapiInt, TagId: MAPIGender, Data: int32(1)},
+		// Outlook stores dates at midnight local time.
+		{TagType: szmapiSystime, TagId: MAPIBirthday, Data: time.Date(1980, 2, 14, 23, 0, 0, 0, time.UTC)},
+		{TagType: szmapiSystime, TagId: MAPILastModificationTime, Data: time.Date(2018, 11, 6, 15, 0, 0, 0, time.UTC)},
+	}
+	props = append(props, namedProps(t,
+		"PidLidEmail1AddressType", "SMTP",
+		"PidLidEmail1EmailAddress", "jane@example.com",
+		"PidLidEmail2AddressType", "EX",
+		"PidLidEmail2EmailAddress", "/o=Example/ou=Exchange/cn=Recipients/cn=jane",
+		"PidLidEmail3AddressType", "SMTP",
+		"PidLidEmail3EmailAddress", "jane.doe@example.org",
+		"PidLidWorkAddressStreet", "2 Work Street\r\nFloor 3",
+		"PidLidWorkAddressCity", "Springfield",
+		"PidLidWorkAddressPostalCode", "12345",
+		"PidLidWorkAddressCountry", "USA",
+		"PidLidPostalAddressId", int32(2),
+	)...)
+	in := &Data{
+		MessageClass: []byte("IPM.Contact"),
+		Subject:      "Jane Doe",
+		Body:         []byte("Met at the conference; likes tea."),
+		Properties:   MsgPropertyList{Values: props},
+		Attachments: []*Attachment{
+			{Title: "notes.txt", Data: []byte("not a photo")},
+			{
+				Title: "ContactPicture.jpg", Data: []byte{0xff, 0xd8, 0xff, 0xe0},
+				Properties: MsgPropertyList{Values: []*Property{
+					{TagType: szmapiBoolean, TagId: MAPITagAttachmentContactPhoto, Data: true},
+				}},
+			},
+		},
+	}
+
+	want := strings.Join([]string{
+		"BEGIN:VCARD",
+		"VERSION:4.0",
+		"PRODID:-//teamwork//tnef//EN",
+		"FN:Jane Doe",
+		"N:Doe;Jane;;Dr.;",
+		"GENDER:F",
+		"BDAY:19800215",
+		"EMAIL;PREF=1:jane@example.com",
+		"EMAIL;PREF=3:jane.doe@example.org",
+		"TEL;TYPE=work,voice:+1 555 0100",
+		"TEL;TYPE=cell:+1 555 0199",
+		"ADR;TYPE=home:;;1 Home Road;Springfield;;;",
+		`ADR;TYPE=work;PREF=1:;;2 Work Street\nFloor 3;Springfield;;12345;USA`,
+		`ORG:Example\, Inc.`,
+		"TITLE:Head of Research",
+		"URL;TYPE=work:https://example.com",
+		`NOTE:Met at the conference\; likes tea.`,
+		"PHOTO:data:image/jpeg;base64,/9j/4A==",
+		"REV:20181106T150000Z",
+		"END:VCARD",
+		"",
+	}, "\r\n")
+
+	// Go through Encode, as in TestEncodeICalendar.
+	var buf bytes.Buffer
+	if err := Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := EncodeVCard(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestEncodeVCardNotContact(t *testing.T) {
+	for _, class := range []string{"IPM.Note", "IPM.DistList", "IPM.Contacts"} {
+		err := EncodeVCard(&bytes.Buffer{}, &Data{MessageClass: []byte(class)})
+		if !errors.Is(err, ErrNotContact) {
+			t.Errorf("%s: %v", class, err)
+		}
+	}
+}